@@ -1,32 +1,96 @@
 package cli
 
 import (
+	"strings"
+
 	"github.com/alexflint/go-arg"
 )
 
 type CommandType struct {
-	Command    string `arg:"positional,required" help:"Command to execute: add, get, list, create, remove"`
-	FromFile   string `arg:"-f" help:"Path to environment file"`
-	Identifier string `arg:"-i" help:"Unique identifier for the environment configuration"`
-	RestoreAs  string `arg:"-r" help:"Filename to restore the environment file as (default: .env)"`
+	Command       string   `arg:"positional,required" help:"Command to execute: init, hook, scan, doctor, add, get, list, create, remove, rotate, keygen, recipients, set, unset, diff, edit, history, rollback, validate, template, run, export, import"`
+	Args          []string `arg:"positional" help:"Arguments of the command"`
+	FromFile      string   `arg:"-f" help:"Path to environment file"`
+	Identifier    string   `arg:"-i" help:"Unique identifier for the environment configuration"`
+	RestoreAs     string   `arg:"-r" help:"Filename to restore the environment file as (default: .env)"`
+	NewSecretFile string   `arg:"--new-secret-file" help:"Path to the file holding the new secret (rotate)"`
+	Output        string   `arg:"-o" help:"Path of the file to write (keygen, export, template)"`
+	Format        string   `arg:"--format" default:"dotenv" help:"Format: dotenv, json, yaml, shell, systemd, docker, kubernetes (export) or dotenv, json, yaml, compose (import)"`
+	Service       string   `arg:"--service" help:"docker-compose service to read the environment of (import)"`
+	Against       string   `arg:"--against" help:"Identifier to compare with (diff)"`
+	ShowValues    bool     `arg:"--show-values" help:"Show values instead of masking them (diff)"`
+	Note          string   `arg:"--description" help:"Description of the configuration (add, create, import)"`
+	Tags          []string `arg:"--tag,separate" help:"Tag of the configuration, can be repeated (add, create, import)"`
+	Force         bool     `arg:"--force" help:"Overwrite a restore target with local changes (get)"`
+	Backup        bool     `arg:"--backup" help:"Keep a timestamped copy of a restore target with local changes (get)"`
+	Merge         bool     `arg:"--merge" help:"Keep the variables only the restore target has (get)"`
+	Fix           bool     `arg:"--fix" help:"Repair the problems that can be fixed (doctor)"`
+	Yes           bool     `arg:"-y,--yes" help:"Do not ask for confirmation (doctor --fix)"`
+	To            int      `arg:"--to" help:"Revision to restore as a new one (rollback)"`
+	Staged        bool     `arg:"--staged" help:"Check the files staged in git instead of the given paths (scan)"`
+	Verbose       bool     `arg:"-v,--verbose" help:"Print progress messages"`
 }
 
 func (CommandType) Description() string {
 	return `Environment Manager - Securely store and manage environment configurations
 
 Commands:
+  init     Create the env-manager folder and add .secret and restore targets to .gitignore
+  hook install
+           Install a git pre-commit hook that runs scan --staged
+  scan     Check files for restored env files and stored values: scan --staged or scan <path>...
+  doctor   Check that the manifest and the encrypted files agree and that .secret is private, --fix repairs
   add      Add an environment file with headers (requires -f)
   get      Retrieve and restore an environment configuration (requires -i)
+           Refuses to replace local changes unless --force, --backup or --merge
   list     List all saved environment configurations
   create   Create environment configuration from a file without headers (requires -f, -i)
   remove   Remove an environment configuration (requires -i)
+  rotate   Re-encrypt every configuration with a new secret (requires --new-secret-file)
+  keygen   Generate a personal X25519 identity and print its public key
+  recipients list|add <name> <public-key>|remove <name>
+           Manage who the configurations are encrypted for
+  set      Set variables of a configuration: set -i <id> KEY=value...
+  unset    Remove variables from a configuration: unset -i <id> KEY...
+  diff     Compare a configuration with another one or a local file (requires -i and --against or -f)
+  edit     Open a configuration in $EDITOR and encrypt it again on save (requires -i)
+  history  List the revisions of a configuration with their author and changed variables (requires -i)
+  rollback Save an earlier revision of a configuration as a new one (requires -i, --to)
+  validate Check configurations against .env-manager/schema.yaml (all, or -i <id>)
+  template Write a .env.example with the keys and comments of a configuration, without values (requires -i)
+  run      Run a command with the configuration in its environment: run -i <id> -- <command>
+  export   Print a configuration in another format (requires -i, --format)
+  import   Create a configuration from a JSON, YAML, docker-compose or dotenv file (requires -f, -i, --format)
 
 Examples:
+  env-manager init
+  env-manager hook install
+  env-manager scan --staged
+  env-manager doctor
+  env-manager doctor --fix --yes
   env-manager add -f .env.local
   env-manager create -f secrets.txt -i production -r .env.prod
+  env-manager create -f secrets.txt -i staging --description "Staging cluster" --tag k8s --tag eu
   env-manager get -i production
+  env-manager get -i production --verbose
+  env-manager get -i production --backup --merge
   env-manager list
-  env-manager remove -i production`
+  env-manager remove -i production
+  env-manager rotate --new-secret-file .secret.new
+  env-manager keygen -o .identity
+  env-manager recipients add alice env-manager-pub-...
+  env-manager set -i production API_KEY=secret123
+  env-manager unset -i production API_KEY
+  env-manager diff -i staging --against production
+  env-manager diff -i production -f .env --show-values
+  env-manager edit -i production
+  env-manager history -i production
+  env-manager rollback -i production --to 3
+  env-manager validate -i production
+  env-manager template -i production
+  env-manager template -i production -o config/.env.example
+  env-manager run -i production -- npm start
+  env-manager export -i production --format kubernetes -o secret.yaml
+  env-manager import -f docker-compose.yml --format compose --service web -i production`
 }
 
 func (c *CommandType) validateCommand() {
@@ -36,10 +100,10 @@ func (c *CommandType) validateCommand() {
 		}
 	}
 
-	panic("Invalid command. Valid commands are add, get, list, remove, and create")
+	panic("Invalid command. Valid commands are " + strings.Join(validCommands, ", "))
 }
 
-var validCommands [5]string = [5]string{"add", "get", "list", "remove", "create"}
+var validCommands = []string{"init", "hook", "scan", "doctor", "add", "get", "list", "remove", "create", "rotate", "keygen", "recipients", "set", "unset", "diff", "edit", "history", "rollback", "validate", "template", "run", "export", "import"}
 
 func ParseArgs() CommandType {
 	var cmd CommandType
@@ -0,0 +1,204 @@
+// Package envmanager loads configurations stored by env-manager into a
+// running Go program.
+//
+//	if err := envmanager.Load("production"); err != nil {
+//		log.Fatal(err)
+//	}
+package envmanager
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/thinktwiceco/env-manager/manager"
+)
+
+type options struct {
+	store    manager.Store
+	folder   string
+	secret   string
+	override bool
+}
+
+// Option changes how a configuration is loaded
+type Option func(*options)
+
+// WithFolder reads the configurations from folder instead of searching
+// for the project upwards from the working directory
+func WithFolder(folder string) Option {
+	return func(o *options) {
+		o.folder = folder
+	}
+}
+
+// WithStore reads the configurations from store, for folders that are not
+// on the local disk. The secret is looked up in the working directory
+func WithStore(store manager.Store) Option {
+	return func(o *options) {
+		o.store = store
+	}
+}
+
+// WithSecret decrypts with secret instead of reading ENV_MANAGER_SECRET
+// or the .secret file
+func WithSecret(secret string) Option {
+	return func(o *options) {
+		o.secret = secret
+	}
+}
+
+// NoOverride keeps the variables that are already set in the environment
+func NoOverride() Option {
+	return func(o *options) {
+		o.override = false
+	}
+}
+
+/// Functions
+
+// Load decrypts the configuration in memory and sets its variables in the
+// environment of the current process
+func Load(identifier string, opts ...Option) error {
+	o := newOptions(opts)
+
+	vars, err := load(identifier, o)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range vars {
+		if !o.override {
+			if _, ok := os.LookupEnv(key); ok {
+				continue
+			}
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return fmt.Errorf("setting %s: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+// LoadMap decrypts the configuration in memory and returns its variables
+// without touching the environment. NoOverride leaves out the variables
+// that are already set
+func LoadMap(identifier string, opts ...Option) (map[string]string, error) {
+	o := newOptions(opts)
+
+	vars, err := load(identifier, o)
+	if err != nil {
+		return nil, err
+	}
+
+	if !o.override {
+		for key := range vars {
+			if _, ok := os.LookupEnv(key); ok {
+				delete(vars, key)
+			}
+		}
+	}
+
+	return vars, nil
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{override: true}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func load(identifier string, o *options) (map[string]string, error) {
+	f, secretDir, err := openFolder(o)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := o.secret
+	if secret == "" {
+		s, err := manager.InitSecretFrom(secretDir)
+		if err != nil {
+			return nil, err
+		}
+		secret = s.GetSecret()
+	}
+
+	d, err := f.LoadVariables(identifier, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.Map(), nil
+}
+
+// openFolder opens the store selected by the options, or the one of the
+// project found upwards from the working directory. It also returns the
+// directory of the .secret file
+func openFolder(o *options) (*manager.Folder, string, error) {
+	if o.store != nil {
+		f, err := manager.OpenFolder(o.store)
+		return f, ".", err
+	}
+
+	if o.folder != "" {
+		if _, err := os.Stat(o.folder); errors.Is(err, fs.ErrNotExist) {
+			return nil, "", fmt.Errorf("%w: %s", manager.ErrNotFound, o.folder)
+		}
+		// The .secret file lives next to the .env-manager folder
+		f, err := manager.OpenFolder(manager.NewDirStore(o.folder))
+		return f, filepath.Dir(o.folder), err
+	}
+
+	dir, err := findProject()
+	if err != nil {
+		return nil, "", err
+	}
+	config, err := manager.LoadProjectConfig(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	store, err := config.OpenStore(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	// Reading a configuration never creates the local folder
+	if s, ok := store.(*manager.DirStore); ok {
+		if _, err := os.Stat(s.Path); errors.Is(err, fs.ErrNotExist) {
+			return nil, "", fmt.Errorf("%w: %s", manager.ErrNotFound, s.Path)
+		}
+	}
+	f, err := manager.OpenFolder(store)
+	return f, dir, err
+}
+
+// findProject searches the working directory and its parents for a
+// .env-manager folder or a .env-manager.json configuration
+func findProject() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		for _, name := range []string{manager.PROJECT_CONFIG, manager.DEFAULT_ENV_FOLDER} {
+			_, err := os.Stat(filepath.Join(dir, name))
+			if err == nil {
+				return dir, nil
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return "", err
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("%w: no %s folder in %s or its parents", manager.ErrNotFound, manager.DEFAULT_ENV_FOLDER, dir)
+		}
+		dir = parent
+	}
+}
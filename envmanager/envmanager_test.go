@@ -0,0 +1,165 @@
+package envmanager
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/thinktwiceco/env-manager/manager"
+)
+
+const TEST_SECRET = "a test passphrase"
+
+// saveTestConfig stores a configuration in dir/.env-manager
+func saveTestConfig(t *testing.T, dir string, identifier string, content string) {
+	t.Helper()
+	folder := filepath.Join(dir, manager.DEFAULT_ENV_FOLDER)
+	f, err := manager.GetOrCreateFolder(&folder)
+	if err != nil {
+		t.Fatalf("GetOrCreateFolder() = %v, want %v", err, nil)
+	}
+	if err := f.AddFileIdentifier(manager.EnvFilePath(identifier), manager.EnvFileIdentifier(identifier)); err != nil {
+		t.Fatalf("AddFileIdentifier() = %v, want %v", err, nil)
+	}
+
+	e := manager.InitEnvFile(identifier, manager.DEFAULT_RESTORE_AS)
+	e.SetContent(content)
+	if err := manager.SaveEnvFile(e, TEST_SECRET, &folder); err != nil {
+		t.Fatalf("SaveEnvFile() = %v, want %v", err, nil)
+	}
+}
+
+func TestLoadMapFindsFolderInParent(t *testing.T) {
+	root := t.TempDir()
+	saveTestConfig(t, root, "production", "HELLO=WORLD\nEMPTY=\n")
+	if err := os.WriteFile(filepath.Join(root, manager.DOT_SECRET), []byte(TEST_SECRET), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	nested := filepath.Join(root, "cmd", "server")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(nested)
+	t.Setenv(manager.ENV_SECRET, "")
+
+	vars, err := LoadMap("production")
+	if err != nil {
+		t.Fatalf("LoadMap() = %v, want %v", err, nil)
+	}
+
+	if vars["HELLO"] != "WORLD" {
+		t.Errorf("LoadMap() HELLO = %v, want %v", vars["HELLO"], "WORLD")
+	}
+	if value, ok := vars["EMPTY"]; !ok || value != "" {
+		t.Errorf("LoadMap() EMPTY = %q, %v, want %q, %v", value, ok, "", true)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	root := t.TempDir()
+	saveTestConfig(t, root, "production", "ENVMANAGER_TEST_A=from-config\nENVMANAGER_TEST_B=from-config\n")
+	folder := filepath.Join(root, manager.DEFAULT_ENV_FOLDER)
+
+	t.Setenv("ENVMANAGER_TEST_A", "from-env")
+	t.Setenv("ENVMANAGER_TEST_B", "")
+	os.Unsetenv("ENVMANAGER_TEST_B")
+
+	if err := Load("production", WithFolder(folder), WithSecret(TEST_SECRET), NoOverride()); err != nil {
+		t.Fatalf("Load() = %v, want %v", err, nil)
+	}
+	if got := os.Getenv("ENVMANAGER_TEST_A"); got != "from-env" {
+		t.Errorf("Load() with NoOverride ENVMANAGER_TEST_A = %v, want %v", got, "from-env")
+	}
+	if got := os.Getenv("ENVMANAGER_TEST_B"); got != "from-config" {
+		t.Errorf("Load() with NoOverride ENVMANAGER_TEST_B = %v, want %v", got, "from-config")
+	}
+
+	if err := Load("production", WithFolder(folder), WithSecret(TEST_SECRET)); err != nil {
+		t.Fatalf("Load() = %v, want %v", err, nil)
+	}
+	if got := os.Getenv("ENVMANAGER_TEST_A"); got != "from-config" {
+		t.Errorf("Load() ENVMANAGER_TEST_A = %v, want %v", got, "from-config")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	root := t.TempDir()
+	saveTestConfig(t, root, "production", "HELLO=WORLD\n")
+	folder := filepath.Join(root, manager.DEFAULT_ENV_FOLDER)
+
+	if _, err := LoadMap("staging", WithFolder(folder), WithSecret(TEST_SECRET)); !errors.Is(err, manager.ErrNotFound) {
+		t.Errorf("LoadMap() = %v, want %v", err, manager.ErrNotFound)
+	}
+
+	if _, err := LoadMap("production", WithFolder(folder), WithSecret("wrong")); !errors.Is(err, manager.ErrBadKey) {
+		t.Errorf("LoadMap() = %v, want %v", err, manager.ErrBadKey)
+	}
+
+	t.Chdir(t.TempDir())
+	if _, err := LoadMap("production", WithSecret(TEST_SECRET)); !errors.Is(err, manager.ErrNotFound) {
+		t.Errorf("LoadMap() = %v, want %v", err, manager.ErrNotFound)
+	}
+
+	// A configured folder that does not exist is not created
+	os.WriteFile(manager.PROJECT_CONFIG, []byte(`{"store": {"type": "dir", "path": "configs"}}`), 0644)
+	if _, err := LoadMap("production", WithSecret(TEST_SECRET)); !errors.Is(err, manager.ErrNotFound) {
+		t.Errorf("LoadMap() = %v, want %v", err, manager.ErrNotFound)
+	}
+	if _, err := os.Stat("configs"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("LoadMap() created the folder: %v", err)
+	}
+}
+
+func TestLoadMapWithStore(t *testing.T) {
+	store := manager.NewMemoryStore()
+	f, err := manager.OpenFolder(store)
+	if err != nil {
+		t.Fatalf("OpenFolder() = %v, want %v", err, nil)
+	}
+	f.AddFileIdentifier(manager.EnvFilePath("production"), manager.EnvFileIdentifier("production"))
+	e := manager.InitEnvFile("production", manager.DEFAULT_RESTORE_AS)
+	e.SetContent("HELLO=MEMORY\n")
+	if err := f.SaveEnvFile(e, TEST_SECRET); err != nil {
+		t.Fatalf("SaveEnvFile() = %v, want %v", err, nil)
+	}
+
+	vars, err := LoadMap("production", WithStore(store), WithSecret(TEST_SECRET))
+	if err != nil {
+		t.Fatalf("LoadMap() = %v, want %v", err, nil)
+	}
+	if vars["HELLO"] != "MEMORY" {
+		t.Errorf("LoadMap() HELLO = %v, want %v", vars["HELLO"], "MEMORY")
+	}
+}
+
+func TestLoadMapUsesProjectConfig(t *testing.T) {
+	root := t.TempDir()
+	folder := filepath.Join(root, "configs")
+	f, err := manager.GetOrCreateFolder(&folder)
+	if err != nil {
+		t.Fatalf("GetOrCreateFolder() = %v, want %v", err, nil)
+	}
+	f.AddFileIdentifier(manager.EnvFilePath("production"), manager.EnvFileIdentifier("production"))
+	e := manager.InitEnvFile("production", manager.DEFAULT_RESTORE_AS)
+	e.SetContent("HELLO=CONFIGURED\n")
+	if err := f.SaveEnvFile(e, TEST_SECRET); err != nil {
+		t.Fatalf("SaveEnvFile() = %v, want %v", err, nil)
+	}
+
+	config := `{"store": {"type": "dir", "path": "configs"}}`
+	if err := os.WriteFile(filepath.Join(root, manager.PROJECT_CONFIG), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(root)
+
+	vars, err := LoadMap("production", WithSecret(TEST_SECRET))
+	if err != nil {
+		t.Fatalf("LoadMap() = %v, want %v", err, nil)
+	}
+	if vars["HELLO"] != "CONFIGURED" {
+		t.Errorf("LoadMap() HELLO = %v, want %v", vars["HELLO"], "CONFIGURED")
+	}
+}
@@ -2,6 +2,10 @@ module github.com/thinktwiceco/env-manager
 
 go 1.25.3
 
-require github.com/alexflint/go-arg v1.6.0
+require (
+	github.com/alexflint/go-arg v1.6.0
+	golang.org/x/crypto v0.54.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require github.com/alexflint/go-scalar v1.2.0 // indirect
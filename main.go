@@ -1,8 +1,15 @@
 package main
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"log"
 	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
 
 	"github.com/thinktwiceco/env-manager/cli"
 	"github.com/thinktwiceco/env-manager/manager"
@@ -16,18 +23,63 @@ type ISecret interface {
 func main() {
 	// Take input
 	c := cli.ParseArgs()
-	fmt.Print("Command: ")
-	fmt.Println(c.Command)
-	fmt.Print("File: ")
-	fmt.Println(c.FromFile)
 
-	s := manager.InitSecret()
+	// Keep stdout for the output of the command
+	out := os.Stdout
+	if c.Command == "run" || (c.Command == "export" && c.Output == "") {
+		out = os.Stderr
+	}
+
+	if c.Verbose {
+		manager.SetLogger(log.New(out, "", 0))
+		fmt.Fprint(out, "Command: ")
+		fmt.Fprintln(out, c.Command)
+		fmt.Fprint(out, "File: ")
+		fmt.Fprintln(out, c.FromFile)
+	}
+
+	// keygen creates a secret, it does not need one
+	if c.Command == "keygen" {
+		keygen(c.Output)
+		return
+	}
+
+	// init can run before a secret exists
+	if c.Command == "init" {
+		initProject()
+		return
+	}
+
+	if c.Command == "hook" {
+		hook(c.Args)
+		return
+	}
+
+	// doctor checks the store without a secret, but cannot decrypt
+	if c.Command == "doctor" {
+		doctor(c.Fix, c.Yes)
+		return
+	}
+
+	// scan still checks file names without a secret
+	if c.Command == "scan" {
+		scan(c.Staged, c.Args)
+		return
+	}
+
+	s, err := manager.InitSecret()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	setAuthor()
 
 	if c.Command == "add" {
 		if c.FromFile == "" {
 			panic("No file path provided")
 		}
-		init_(c.FromFile, &s)
+		init_(c.FromFile, c.Note, c.Tags, &s)
 	}
 
 	if c.Command == "get" {
@@ -35,7 +87,7 @@ func main() {
 			panic("No identifier provided")
 		}
 
-		get(c.Identifier, &s)
+		get(c.Identifier, manager.RestoreOptions{Force: c.Force, Backup: c.Backup, Merge: c.Merge}, &s)
 	}
 
 	if c.Command == "list" {
@@ -49,7 +101,7 @@ func main() {
 		if c.FromFile == "" {
 			panic("No file path provided")
 		}
-		create(c.FromFile, c.Identifier, c.RestoreAs, &s)
+		create(c.FromFile, c.Identifier, c.RestoreAs, c.Note, c.Tags, &s)
 	}
 
 	if c.Command == "remove" {
@@ -59,52 +111,476 @@ func main() {
 		remove(c.Identifier)
 	}
 
+	if c.Command == "rotate" {
+		if c.NewSecretFile == "" {
+			panic("No new secret file provided")
+		}
+		rotate(c.NewSecretFile, &s)
+	}
+
+	if c.Command == "recipients" {
+		recipients(c.Args, &s)
+	}
+
+	if c.Command == "set" {
+		if c.Identifier == "" {
+			panic("No identifier provided")
+		}
+		if len(c.Args) == 0 {
+			panic("No variable provided, use KEY=value")
+		}
+		set(c.Identifier, c.Args, &s)
+	}
+
+	if c.Command == "unset" {
+		if c.Identifier == "" {
+			panic("No identifier provided")
+		}
+		if len(c.Args) == 0 {
+			panic("No variable provided")
+		}
+		unset(c.Identifier, c.Args, &s)
+	}
+
+	if c.Command == "diff" {
+		if c.Identifier == "" {
+			panic("No identifier provided")
+		}
+		if (c.Against == "") == (c.FromFile == "") {
+			panic("Provide either --against or a file path")
+		}
+		diff(c.Identifier, c.Against, c.FromFile, c.ShowValues, &s)
+	}
+
+	if c.Command == "edit" {
+		if c.Identifier == "" {
+			panic("No identifier provided")
+		}
+		edit(c.Identifier, &s)
+	}
+
+	if c.Command == "history" {
+		if c.Identifier == "" {
+			panic("No identifier provided")
+		}
+		history(c.Identifier, &s)
+	}
+
+	if c.Command == "rollback" {
+		if c.Identifier == "" {
+			panic("No identifier provided")
+		}
+		if c.To <= 0 {
+			panic("No revision provided, use rollback -i <id> --to <revision>")
+		}
+		rollback(c.Identifier, c.To, &s)
+	}
+
+	if c.Command == "run" {
+		if c.Identifier == "" {
+			panic("No identifier provided")
+		}
+		if len(c.Args) == 0 {
+			panic("No command provided, use run -i <id> -- <command>")
+		}
+		run(c.Identifier, c.Args, &s)
+	}
+
+	if c.Command == "export" {
+		if c.Identifier == "" {
+			panic("No identifier provided")
+		}
+		export(c.Identifier, c.Format, c.Output, &s)
+	}
+
+	if c.Command == "template" {
+		if c.Identifier == "" {
+			panic("No identifier provided")
+		}
+		template(c.Identifier, c.Output, &s)
+	}
+
+	if c.Command == "validate" {
+		validate(c.Identifier, &s)
+	}
+
+	if c.Command == "import" {
+		if c.Identifier == "" {
+			panic("No identifier provided")
+		}
+		if c.FromFile == "" {
+			panic("No file path provided")
+		}
+		import_(c.FromFile, c.Format, c.Service, c.Identifier, c.RestoreAs, c.Note, c.Tags, &s)
+	}
+
+}
+
+// initProject creates the env-manager folder and makes sure git ignores
+// the secret and every restored plaintext file, but not the encrypted
+// files. It refuses to run if one of those files is already tracked.
+func initProject() {
+	fmt.Println(">> Initializing env-manager...")
+
+	f, err := manager.OpenProjectFolder()
+	if err != nil {
+		fmt.Printf("Error opening store: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Restore targets are in the encrypted headers, a secret is optional
+	secret := ""
+	if s, err := manager.InitSecret(); err == nil {
+		secret = s.GetSecret()
+	}
+
+	targets, err := f.RestoreTargets(secret)
+	if err != nil {
+		fmt.Printf("Error reading restore targets: %v\n", err)
+		os.Exit(1)
+	}
+	ignored := append([]string{manager.DOT_SECRET}, targets...)
+
+	tracked, err := manager.TrackedFiles(".", ignored)
+	if err != nil {
+		fmt.Printf("Error checking git: %v\n", err)
+		os.Exit(1)
+	}
+	if len(tracked) > 0 {
+		fmt.Println("Error: plaintext files are tracked by git:")
+		for _, t := range tracked {
+			fmt.Printf("\t> %s\n", t)
+		}
+		fmt.Printf("Untrack them with `git rm --cached %s` and rotate the exposed values\n", strings.Join(tracked, " "))
+		os.Exit(1)
+	}
+
+	// Backups made by get --backup hold plaintext too
+	for _, t := range targets {
+		ignored = append(ignored, manager.BackupPattern(t))
+	}
+
+	// The lock file of a local store changes on every run
+	if _, ok := f.Store().(*manager.DirStore); ok {
+		ignored = append(ignored, filepath.Join(f.FolderPath, manager.LOCK_FILE))
+	}
+
+	added, err := manager.UpdateGitignore(".", ignored)
+	if err != nil {
+		fmt.Printf("Error updating %s: %v\n", manager.GITIGNORE_FILE, err)
+		os.Exit(1)
+	}
+	for _, a := range added {
+		fmt.Printf("\t> Added %s to %s\n", a, manager.GITIGNORE_FILE)
+	}
+	if len(added) == 0 {
+		fmt.Printf("\t> %s is up to date\n", manager.GITIGNORE_FILE)
+	}
+
+	if manager.IgnoresFolder(".", manager.DEFAULT_ENV_FOLDER) {
+		fmt.Printf("\t> Note: %s ignores %s. It only holds encrypted files, remove that line to share them\n", manager.GITIGNORE_FILE, manager.DEFAULT_ENV_FOLDER)
+	}
+
+	fmt.Printf("\t> Store ready: %s\n", f.FolderPath)
+}
+
+// hook installs the git pre-commit hook that runs scan --staged
+func hook(args []string) {
+	if len(args) != 1 || args[0] != "install" {
+		fmt.Println("Usage: env-manager hook install")
+		os.Exit(1)
+	}
+
+	path, err := manager.InstallHook(".")
+	if errors.Is(err, manager.ErrHookExists) {
+		fmt.Printf("Error: %v\n", err)
+		fmt.Println("Add `env-manager scan --staged` to it to enable the check")
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Printf("Error installing the hook: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf(">> Installed pre-commit hook: %s\n", path)
+}
+
+// scan reports staged files, or the given files, that are restored
+// configurations or contain a stored value. It exits with 1 if any is found
+func scan(staged bool, paths []string) {
+	if !staged && len(paths) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: env-manager scan --staged | env-manager scan <path>...")
+		os.Exit(1)
+	}
+
+	f, err := manager.OpenProjectFolder()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening store: %v\n", err)
+		os.Exit(1)
+	}
+
+	secret := ""
+	if s, err := manager.InitSecret(); err == nil {
+		secret = s.GetSecret()
+	} else {
+		fmt.Fprintln(os.Stderr, "Warning: no secret, only file names are checked")
+	}
+
+	scanner, err := f.NewScanner(secret)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading configurations: %v\n", err)
+		os.Exit(1)
+	}
+
+	var findings []manager.Finding
+	if staged {
+		findings, err = scanner.ScanStaged(".")
+	} else {
+		findings, err = scanner.ScanFiles(paths)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(findings) == 0 {
+		return
+	}
+
+	fmt.Fprintln(os.Stderr, "env-manager: refusing to commit plaintext secrets")
+	for _, finding := range findings {
+		fmt.Fprintf(os.Stderr, "\t> %s\n", finding)
+	}
+	fmt.Fprintln(os.Stderr, "Unstage them with `git restore --staged <file>`, or commit with --no-verify if they are safe")
+	os.Exit(1)
+}
+
+// doctor reports problems of the store and the secret file. With fix it
+// repairs the fixable ones after asking for confirmation, unless yes is
+// set. It exits with 1 if problems remain.
+func doctor(fix bool, yes bool) {
+	fmt.Println(">> Checking env-manager store...")
+
+	f, err := manager.OpenProjectFolder()
+	if err != nil {
+		fmt.Printf("Error opening store: %v\n", err)
+		os.Exit(1)
+	}
+	// Check under the lock so the fixes apply to what was reported
+	if fix {
+		defer lock(f)()
+	}
+
+	secret := ""
+	if s, err := manager.InitSecret(); err == nil {
+		secret = s.GetSecret()
+	} else {
+		fmt.Println("\t> No secret, configurations are not decrypted")
+	}
+
+	problems, err := f.Check(secret)
+	if err != nil {
+		fmt.Printf("Error checking store: %v\n", err)
+		os.Exit(1)
+	}
+	if p := manager.CheckSecretFile("."); p != nil {
+		problems = append(problems, *p)
+	}
+
+	if len(problems) == 0 {
+		fmt.Printf("\t> %s is healthy\n", f.FolderPath)
+		return
+	}
+
+	var fixable []manager.Problem
+	for _, p := range problems {
+		fmt.Printf("\t> %s\n", p)
+		if p.Fixable {
+			fixable = append(fixable, p)
+		}
+	}
+
+	if !fix || len(fixable) == 0 {
+		if len(fixable) > 0 {
+			fmt.Printf("\n>> %d of %d problems can be fixed with --fix\n", len(fixable), len(problems))
+		}
+		os.Exit(1)
+	}
+
+	if !yes && !confirm(fmt.Sprintf("\nFix %d problems?", len(fixable))) {
+		fmt.Println("\t> Nothing was changed")
+		os.Exit(1)
+	}
+
+	fixed := 0
+	for _, p := range fixable {
+		if err := f.Fix(p, secret); err != nil {
+			fmt.Printf("\t> Error fixing %s: %v\n", p, err)
+			continue
+		}
+		fixed++
+		fmt.Printf("\t> Fixed %s\n", p)
+	}
+
+	if fixed < len(problems) {
+		fmt.Printf("\n>> %d problems remain\n", len(problems)-fixed)
+		os.Exit(1)
+	}
+}
+
+// confirm asks a yes/no question on the terminal. Anything but y or yes
+// is a no
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
 }
 
 // list retrieves all the environment files from the default environment folder
 // and prints "List" to the console.
 func list() {
 	fmt.Println(">> Listing environment configurations...")
-	envFiles, err := manager.GetEnvFiles(&manager.DEFAULT_ENV_FOLDER)
+	f, err := manager.OpenProjectFolder()
 	if err != nil {
-		fmt.Printf("Error getting environment files: %v\n", err)
+		fmt.Printf("Error opening store: %v\n", err)
 		return
 	}
-	fmt.Printf("\n>> Found %d environment configurations\n", len(envFiles))
-	for _, e := range envFiles {
-		fmt.Printf("\t> %s\n", e.Identifier())
+	identifiers := f.Identifiers()
+	fmt.Printf("\n>> Found %d environment configurations\n", len(identifiers))
+	for _, id := range identifiers {
+		entry, _ := f.Entry(id)
+		fmt.Printf("\t> %s", id)
+		if entry.RestoreAs != "" {
+			fmt.Printf(" -> %s", entry.RestoreAs)
+		}
+		fmt.Printf(" (updated %s)\n", entry.UpdatedAt.Local().Format("2006-01-02 15:04"))
+		if entry.Description != "" {
+			fmt.Printf("\t  %s\n", entry.Description)
+		}
+		if len(entry.Tags) > 0 {
+			fmt.Printf("\t  tags: %s\n", strings.Join(entry.Tags, ", "))
+		}
+	}
+}
+
+// lock takes the store lock for a command that changes the store and
+// returns its release. A lock left by os.Exit is released with the process
+func lock(f *manager.Folder) func() {
+	unlock, err := f.Lock(manager.LOCK_TIMEOUT)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return func() { unlock() }
+}
+
+// setAuthor names the git user as author of the revisions saved, unless
+// ENV_MANAGER_AUTHOR is set
+func setAuthor() {
+	if os.Getenv(manager.ENV_AUTHOR) != "" {
+		return
+	}
+	name, err := exec.Command("git", "config", "user.name").Output()
+	if err == nil && strings.TrimSpace(string(name)) != "" {
+		os.Setenv(manager.ENV_AUTHOR, strings.TrimSpace(string(name)))
+	}
+}
+
+// record stores the source file, description and tags of a configuration
+// that was just saved
+func record(f *manager.Folder, filePath string, identifier string, description string, tags []string) {
+	if err := f.AddFileIdentifier(manager.EnvFilePath(filePath), manager.EnvFileIdentifier(identifier)); err != nil {
+		fmt.Printf("Error updating %s: %v\n", manager.MANIFEST_FILE, err)
+		os.Exit(1)
+	}
+	if description != "" || tags != nil {
+		if err := f.Describe(identifier, description, tags); err != nil {
+			fmt.Printf("Error updating %s: %v\n", manager.MANIFEST_FILE, err)
+			os.Exit(1)
+		}
 	}
 }
 
-// get retrieves the environment file identified by the given identifier,
-// restores it using the provided secret, and prints "Get" to the console.
-func get(identifier string, s ISecret) {
+// get retrieves the environment file identified by the given identifier
+// and restores it using the provided secret. A restore target with local
+// changes is only replaced as opts allow; otherwise the changes are shown
+// masked and the command exits with 1.
+func get(identifier string, opts manager.RestoreOptions, s ISecret) {
 	fmt.Printf("\n>> Getting environment configuration for %s...\n", identifier)
-	e, err := manager.GetEnvFile(identifier, &manager.DEFAULT_ENV_FOLDER)
+	f, err := manager.OpenProjectFolder()
+	if err != nil {
+		fmt.Printf("Error opening store: %v\n", err)
+		return
+	}
+	e, err := f.GetEnvFile(identifier)
 	if err != nil {
 		fmt.Printf("Error getting environment file: %v\n", err)
 		return
 	}
 	secret := s.GetSecret()
-	manager.RestoreEnvFile(e, secret)
-	fmt.Printf("\t> Environment configuration restored as %s", e.RestoreAs())
+	result, err := manager.RestoreEnvFileWith(e, secret, opts)
+
+	var conflict *manager.RestoreConflict
+	if errors.As(err, &conflict) {
+		fmt.Printf("Error: %s has local changes, nothing was written\n", conflict.Path)
+		for _, c := range conflict.Changes {
+			fmt.Printf("\t%s\n", c.String(false))
+		}
+		if len(conflict.Changes) == 0 {
+			fmt.Println("\tOnly comments or formatting differ")
+		}
+		fmt.Println("Use --force to overwrite it, --backup to keep a copy or --merge to keep the local-only variables")
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Printf("Error restoring environment file: %v\n", err)
+		return
+	}
+
+	if result.Unchanged {
+		fmt.Printf("\t> %s is already up to date\n", result.Path)
+		return
+	}
+	if result.Backup != "" {
+		fmt.Printf("\t> Previous content saved as %s\n", result.Backup)
+		// Backups hold plaintext too
+		if _, err := os.Stat(manager.GITIGNORE_FILE); err == nil {
+			if _, err := manager.UpdateGitignore(".", []string{manager.BackupPattern(result.Path)}); err != nil {
+				fmt.Printf("Error updating %s: %v\n", manager.GITIGNORE_FILE, err)
+			}
+		}
+	}
+	if len(result.Kept) > 0 {
+		fmt.Printf("\t> Kept local variables: %s\n", strings.Join(result.Kept, ", "))
+	}
+	fmt.Printf("\t> Environment configuration restored as %s\n", result.Path)
 }
 
 // init_ initializes the environment by reading the environment file from the given file path,
 // saving the environment variables along with the secret provided by ISecret interface.
 // It panics if no file path is provided.
-func init_(filePath string, s ISecret) {
+func init_(filePath string, description string, tags []string, s ISecret) {
 	fmt.Printf("\n>> Initializing environment configuration from %s...\n", filePath)
 	if filePath != "" {
-		f, err := manager.GetOrCreateFolder(&manager.DEFAULT_ENV_FOLDER)
+		f, err := manager.OpenProjectFolder()
+		if err != nil {
+			fmt.Printf("Error opening store: %v\n", err)
+			os.Exit(1)
+		}
+		defer lock(f)()
+		e, err := manager.ReadEnvFile(filePath)
 		if err != nil {
-			panic(err)
+			fmt.Printf("Error reading environment file: %v\n", err)
+			os.Exit(1)
 		}
-		e := manager.ReadEnvFile(filePath)
 		fmt.Println("\t> Saving environment configuration...")
 		secret := s.GetSecret()
-		f.AddFileIdentifier(manager.EnvFilePath(filePath), manager.EnvFileIdentifier(e.Identifier()))
-		manager.SaveEnvFile(e, secret, &manager.DEFAULT_ENV_FOLDER)
+		if err := f.SaveEnvFile(e, secret); err != nil {
+			fmt.Printf("Error saving environment file: %v\n", err)
+			os.Exit(1)
+		}
+		record(f, filePath, e.Identifier(), description, tags)
 		fmt.Println("\t> Environment configuration saved")
 	} else {
 		panic("No file path provided")
@@ -113,13 +589,15 @@ func init_(filePath string, s ISecret) {
 
 // create creates a new environment file from a source file without headers.
 // It uses InitEnvFile to create the env file with the given identifier and restoreAs.
-func create(filePath string, identifier string, restoreAs string, s ISecret) {
+func create(filePath string, identifier string, restoreAs string, description string, tags []string, s ISecret) {
 	fmt.Printf("\n>> Creating environment configuration '%s' from %s...\n", identifier, filePath)
 
-	f, err := manager.GetOrCreateFolder(&manager.DEFAULT_ENV_FOLDER)
+	f, err := manager.OpenProjectFolder()
 	if err != nil {
-		panic(err)
+		fmt.Printf("Error opening store: %v\n", err)
+		os.Exit(1)
 	}
+	defer lock(f)()
 
 	// Set default restoreAs if not provided
 	if restoreAs == "" {
@@ -140,8 +618,51 @@ func create(filePath string, identifier string, restoreAs string, s ISecret) {
 
 	fmt.Println("\t> Saving environment configuration...")
 	secret := s.GetSecret()
-	f.AddFileIdentifier(manager.EnvFilePath(filePath), manager.EnvFileIdentifier(identifier))
-	manager.SaveEnvFile(e, secret, &manager.DEFAULT_ENV_FOLDER)
+	if err := f.SaveEnvFile(e, secret); err != nil {
+		fmt.Printf("Error saving environment file: %v\n", err)
+		os.Exit(1)
+	}
+	record(f, filePath, identifier, description, tags)
+	fmt.Printf("\t> Environment configuration '%s' saved\n", identifier)
+}
+
+// import_ creates a new environment configuration from a JSON, YAML,
+// docker-compose or dotenv file, converted to canonical dotenv content.
+func import_(filePath string, format string, service string, identifier string, restoreAs string, description string, tags []string, s ISecret) {
+	fmt.Printf("\n>> Importing environment configuration '%s' from %s (%s)...\n", identifier, filePath, format)
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		panic(fmt.Sprintf("Error reading file: %v", err))
+	}
+
+	converted, err := manager.ImportVariables(string(content), format, service)
+	if err != nil {
+		fmt.Printf("Error importing %s: %v\n", filePath, err)
+		os.Exit(1)
+	}
+
+	f, err := manager.OpenProjectFolder()
+	if err != nil {
+		fmt.Printf("Error opening store: %v\n", err)
+		os.Exit(1)
+	}
+	defer lock(f)()
+
+	if restoreAs == "" {
+		restoreAs = manager.DEFAULT_RESTORE_AS
+	}
+
+	e := manager.InitEnvFile(identifier, restoreAs)
+	e.SetContent(converted)
+
+	fmt.Println("\t> Saving environment configuration...")
+	secret := s.GetSecret()
+	if err := f.SaveEnvFile(e, secret); err != nil {
+		fmt.Printf("Error saving environment file: %v\n", err)
+		os.Exit(1)
+	}
+	record(f, filePath, identifier, description, tags)
 	fmt.Printf("\t> Environment configuration '%s' saved\n", identifier)
 }
 
@@ -149,37 +670,523 @@ func create(filePath string, identifier string, restoreAs string, s ISecret) {
 func remove(identifier string) {
 	fmt.Printf("\n>> Removing environment configuration '%s'...\n", identifier)
 
-	f, err := manager.GetOrCreateFolder(&manager.DEFAULT_ENV_FOLDER)
+	f, err := manager.OpenProjectFolder()
 	if err != nil {
-		panic(err)
+		fmt.Printf("Error opening store: %v\n", err)
+		return
+	}
+	defer lock(f)()
+
+	// Remove the manifest entries and the encrypted file
+	if err := f.RemoveEnvFile(identifier); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	fmt.Printf("\t> Environment configuration '%s' removed\n", identifier)
+}
+
+// rotate re-encrypts every environment configuration with the secret read
+// from newSecretFile. Nothing is changed if any configuration fails.
+func rotate(newSecretFile string, s ISecret) {
+	fmt.Println("\n>> Rotating secret for all environment configurations...")
+
+	newSecret, err := manager.ReadSecretFile(newSecretFile)
+	if err != nil {
+		fmt.Printf("Error reading new secret: %v\n", err)
+		os.Exit(1)
+	}
+
+	f, err := manager.OpenProjectFolder()
+	if err != nil {
+		fmt.Printf("Error opening store: %v\n", err)
+		os.Exit(1)
+	}
+	defer lock(f)()
+
+	err = f.RotateSecret(s.GetSecret(), newSecret)
+	if err != nil {
+		fmt.Printf("Error rotating secret, no configuration was changed: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("\t> All environment configurations re-encrypted")
+	fmt.Printf("\t> Replace %s or %s with the content of %s\n", manager.DOT_SECRET, manager.ENV_SECRET, newSecretFile)
+}
+
+// set changes variables of a stored environment configuration. The
+// configuration is decrypted in memory only.
+func set(identifier string, assignments []string, s ISecret) {
+	fmt.Printf("\n>> Setting variables of '%s'...\n", identifier)
+
+	values := make(map[string]string)
+	var keys []string
+	for _, a := range assignments {
+		key, value, ok := strings.Cut(a, "=")
+		if !ok {
+			fmt.Printf("Error: invalid assignment %q, use KEY=value\n", a)
+			os.Exit(1)
+		}
+		if err := manager.ValidateKey(key); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if _, exists := values[key]; !exists {
+			keys = append(keys, key)
+		}
+		values[key] = value
+	}
+
+	f, err := manager.OpenProjectFolder()
+	if err != nil {
+		fmt.Printf("Error opening store: %v\n", err)
+		os.Exit(1)
+	}
+	defer lock(f)()
+
+	err = f.UpdateEnvFile(identifier, s.GetSecret(), func(d *manager.Dotenv) error {
+		for _, key := range keys {
+			if err := d.Set(key, values[key]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Error setting variables: %v\n", err)
+		os.Exit(1)
 	}
 
-	// Find and remove the file from manifest
-	var filePathToRemove manager.EnvFilePath
-	for filePath, id := range f.GetIdentifiers() {
-		if string(id) == identifier {
-			filePathToRemove = filePath
-			break
+	for _, key := range keys {
+		fmt.Printf("\t> %s set\n", key)
+	}
+}
+
+// unset removes variables from a stored environment configuration.
+func unset(identifier string, keys []string, s ISecret) {
+	fmt.Printf("\n>> Removing variables from '%s'...\n", identifier)
+
+	f, err := manager.OpenProjectFolder()
+	if err != nil {
+		fmt.Printf("Error opening store: %v\n", err)
+		os.Exit(1)
+	}
+	defer lock(f)()
+
+	err = f.UpdateEnvFile(identifier, s.GetSecret(), func(d *manager.Dotenv) error {
+		for _, key := range keys {
+			if !d.Unset(key) {
+				return fmt.Errorf("%w: %s", manager.ErrVariableNotFound, key)
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Error removing variables: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, key := range keys {
+		fmt.Printf("\t> %s removed\n", key)
 	}
+}
 
-	if filePathToRemove == "" {
-		fmt.Printf("Error: identifier '%s' not found\n", identifier)
+// diff compares a stored environment configuration with another one or
+// with a local file. Both sides are decrypted in memory only.
+func diff(identifier string, against string, filePath string, showValues bool, s ISecret) {
+	f, err := manager.OpenProjectFolder()
+	if err != nil {
+		fmt.Printf("Error opening store: %v\n", err)
 		return
 	}
 
-	// Remove from manifest
-	err = f.EvictFileIdentifier(filePathToRemove)
+	from, err := f.LoadVariables(identifier, s.GetSecret())
 	if err != nil {
-		panic(fmt.Sprintf("Error removing from manifest: %v", err))
+		fmt.Printf("Error reading %s: %v\n", identifier, err)
+		return
 	}
 
-	// Remove the actual encrypted file
-	filePath := fmt.Sprintf("%s/%s%s", manager.DEFAULT_ENV_FOLDER, manager.SAVED_PREFIX, identifier)
-	err = os.Remove(filePath)
+	var to *manager.Dotenv
+	target := against
+	if against != "" {
+		to, err = f.LoadVariables(against, s.GetSecret())
+	} else {
+		target = filePath
+		var content []byte
+		content, err = os.ReadFile(filePath)
+		if err == nil {
+			to, err = manager.ParseDotenv(string(content))
+		}
+	}
 	if err != nil {
-		fmt.Printf("Warning: could not remove file %s: %v\n", filePath, err)
+		fmt.Printf("Error reading %s: %v\n", target, err)
+		return
 	}
 
-	fmt.Printf("\t> Environment configuration '%s' removed\n", identifier)
+	fmt.Printf("\n>> Comparing %s with %s...\n", identifier, target)
+	changes := manager.DiffVariables(from, to)
+	if len(changes) == 0 {
+		fmt.Println("\t> No differences")
+		return
+	}
+
+	for _, c := range changes {
+		fmt.Printf("\t%s\n", c.String(showValues))
+	}
+}
+
+// validate checks stored configurations against the schema of the
+// folder, every configuration if identifier is empty. It exits with 1 if
+// any of them does not match.
+func validate(identifier string, s ISecret) {
+	fmt.Println("\n>> Validating environment configurations...")
+
+	f, err := manager.OpenProjectFolder()
+	if err != nil {
+		fmt.Printf("Error opening store: %v\n", err)
+		os.Exit(1)
+	}
+
+	schema, err := f.LoadSchema()
+	if err != nil {
+		fmt.Printf("Error reading %s: %v\n", manager.SCHEMA_FILE, err)
+		os.Exit(1)
+	}
+	if schema == nil {
+		fmt.Printf("\t> No %s in %s, nothing to check\n", manager.SCHEMA_FILE, f.FolderPath)
+		return
+	}
+
+	identifiers := []string{identifier}
+	if identifier == "" {
+		envFiles, err := f.GetEnvFiles()
+		if err != nil {
+			fmt.Printf("Error getting environment files: %v\n", err)
+			os.Exit(1)
+		}
+		identifiers = identifiers[:0]
+		for _, e := range envFiles {
+			identifiers = append(identifiers, e.Identifier())
+		}
+	}
+
+	failed := false
+	for _, id := range identifiers {
+		err := f.ValidateEnvFile(id, s.GetSecret())
+
+		var invalid *manager.ValidationError
+		switch {
+		case errors.As(err, &invalid):
+			failed = true
+			fmt.Printf("\t> %s does not match the schema:\n", id)
+			for _, problem := range invalid.Problems {
+				fmt.Printf("\t\t- %s\n", problem)
+			}
+		case err != nil:
+			failed = true
+			fmt.Printf("\t> %s: %v\n", id, err)
+		default:
+			fmt.Printf("\t> %s is valid\n", id)
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// edit opens a decrypted copy of the environment configuration in $EDITOR
+// and encrypts it again when it was changed.
+func edit(identifier string, s ISecret) {
+	fmt.Printf("\n>> Editing environment configuration '%s'...\n", identifier)
+
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+	}
+
+	f, err := manager.OpenProjectFolder()
+	if err != nil {
+		fmt.Printf("Error opening store: %v\n", err)
+		return
+	}
+	defer lock(f)()
+
+	changed, err := f.EditEnvFile(identifier, s.GetSecret(), func(path string, problem error) error {
+		// Reopen the same file so the changes are not lost
+		if problem != nil {
+			fmt.Printf("Error: %v\n", problem)
+			if !confirm("Edit again?") {
+				return problem
+			}
+		}
+		cmd := exec.Command(editor[0], append(editor[1:], path)...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		return cmd.Run()
+	})
+	if err != nil {
+		fmt.Printf("Error editing environment configuration, nothing was saved: %v\n", err)
+		return
+	}
+
+	if !changed {
+		fmt.Println("\t> No changes")
+		return
+	}
+
+	fmt.Printf("\t> Environment configuration '%s' saved\n", identifier)
+}
+
+// history lists the revisions of a configuration, newest first, with
+// the names of the variables each one changed
+func history(identifier string, s ISecret) {
+	f, err := manager.OpenProjectFolder()
+	if err != nil {
+		fmt.Printf("Error opening store: %v\n", err)
+		os.Exit(1)
+	}
+
+	revisions, err := f.History(identifier, s.GetSecret())
+	if err != nil {
+		fmt.Printf("Error reading history of %s: %v\n", identifier, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("\n>> History of %s:\n", identifier)
+	for i := len(revisions) - 1; i >= 0; i-- {
+		r := revisions[i]
+		author := r.Author
+		if author == "" {
+			author = "unknown"
+		}
+
+		var keys []string
+		for _, c := range r.Changes {
+			switch c.Kind {
+			case manager.VARIABLE_ADDED:
+				keys = append(keys, "+"+c.Key)
+			case manager.VARIABLE_REMOVED:
+				keys = append(keys, "-"+c.Key)
+			case manager.VARIABLE_CHANGED:
+				keys = append(keys, "~"+c.Key)
+			}
+		}
+		if len(keys) == 0 {
+			keys = []string{"no variable changes"}
+		}
+
+		fmt.Printf("\t%3d  %s  %s  %s\n", r.Number, r.CreatedAt.Local().Format("2006-01-02 15:04"), author, strings.Join(keys, " "))
+	}
+}
+
+// rollback saves an earlier revision of a configuration as a new one
+func rollback(identifier string, to int, s ISecret) {
+	fmt.Printf("\n>> Rolling back %s to revision %d...\n", identifier, to)
+	f, err := manager.OpenProjectFolder()
+	if err != nil {
+		fmt.Printf("Error opening store: %v\n", err)
+		os.Exit(1)
+	}
+	defer lock(f)()
+
+	number, err := f.Rollback(identifier, s.GetSecret(), to)
+	if err != nil {
+		fmt.Printf("Error rolling back %s: %v\n", identifier, err)
+		os.Exit(1)
+	}
+	fmt.Printf("\t> Revision %d saved as revision %d, use `get -i %s` to restore it\n", to, number, identifier)
+}
+
+// run starts command with the environment configuration merged into its
+// environment. Nothing is written to disk. Signals are forwarded to the
+// command and env-manager exits with its exit code.
+func run(identifier string, command []string, s ISecret) {
+	f, err := manager.OpenProjectFolder()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening store: %v\n", err)
+		os.Exit(1)
+	}
+
+	d, err := f.LoadVariables(identifier, s.GetSecret())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", identifier, err)
+		os.Exit(1)
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Env = manager.MergeEnviron(os.Environ(), d)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+	defer signal.Stop(signals)
+
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error starting %s: %v\n", command[0], err)
+		os.Exit(127)
+	}
+
+	go func() {
+		for sig := range signals {
+			cmd.Process.Signal(sig)
+		}
+	}()
+
+	cmd.Wait()
+	os.Exit(exitCode(cmd.ProcessState))
+}
+
+// export renders the environment configuration in another format, to
+// stdout or to output. The configuration is decrypted in memory only.
+func export(identifier string, format string, output string, s ISecret) {
+	f, err := manager.OpenProjectFolder()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening store: %v\n", err)
+		os.Exit(1)
+	}
+
+	d, err := f.LoadVariables(identifier, s.GetSecret())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", identifier, err)
+		os.Exit(1)
+	}
+
+	rendered, err := manager.RenderVariables(d, format, identifier)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error exporting %s: %v\n", identifier, err)
+		os.Exit(1)
+	}
+
+	if output == "" {
+		fmt.Print(rendered)
+		return
+	}
+
+	err = manager.WriteFileAtomic(output, []byte(rendered), 0600)
+	if err != nil {
+		fmt.Printf("Error writing %s: %v\n", output, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("\t> Environment configuration '%s' exported to %s\n", identifier, output)
+}
+
+// template writes an example file of the configuration without its
+// values, to be committed next to the code. The default is .env.example
+func template(identifier string, output string, s ISecret) {
+	fmt.Printf("\n>> Writing template of '%s'...\n", identifier)
+
+	if output == "" {
+		output = manager.DEFAULT_TEMPLATE_AS
+	}
+
+	f, err := manager.OpenProjectFolder()
+	if err != nil {
+		fmt.Printf("Error opening store: %v\n", err)
+		os.Exit(1)
+	}
+
+	rendered, err := f.TemplateEnvFile(identifier, s.GetSecret())
+	if err != nil {
+		fmt.Printf("Error reading %s: %v\n", identifier, err)
+		os.Exit(1)
+	}
+
+	if err := manager.WriteFileAtomic(output, []byte(rendered), 0644); err != nil {
+		fmt.Printf("Error writing %s: %v\n", output, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("\t> Template of '%s' written to %s\n", identifier, output)
+}
+
+// keygen generates a personal identity. It is written to output with
+// owner-only permissions, or printed when no output is given.
+func keygen(output string) {
+	identity, err := manager.GenerateIdentity()
+	if err != nil {
+		panic(err)
+	}
+
+	if output == "" {
+		fmt.Printf("# public key: %s\n", identity.PublicKey())
+		fmt.Println(identity.String())
+		return
+	}
+
+	if _, err := os.Stat(output); err == nil {
+		fmt.Printf("Error: %s already exists\n", output)
+		return
+	}
+
+	err = os.WriteFile(output, []byte(identity.String()+"\n"), 0600)
+	if err != nil {
+		panic(fmt.Sprintf("Error writing identity: %v", err))
+	}
+
+	fmt.Printf(">> Identity saved to %s\n", output)
+	fmt.Printf("\t> Public key: %s\n", identity.PublicKey())
+}
+
+// recipients lists, adds or removes the people the environment
+// configurations are encrypted for.
+func recipients(args []string, s ISecret) {
+	if len(args) == 0 {
+		panic("No recipients command provided: list, add or remove")
+	}
+
+	f, err := manager.OpenProjectFolder()
+	if err != nil {
+		fmt.Printf("Error opening store: %v\n", err)
+		os.Exit(1)
+	}
+	defer lock(f)()
+
+	switch args[0] {
+	case "list":
+		rs, err := f.LoadRecipients()
+		if err != nil {
+			fmt.Printf("Error reading recipients: %v\n", err)
+			os.Exit(1)
+		}
+		if len(rs) == 0 {
+			fmt.Println(">> No recipients, configurations are encrypted with the shared secret")
+			return
+		}
+		fmt.Printf(">> Found %d recipients\n", len(rs))
+		for _, r := range rs {
+			fmt.Printf("\t> %s %s\n", r.Name, r.PublicKey)
+		}
+
+	case "add":
+		if len(args) != 3 {
+			panic("Usage: recipients add <name> <public-key>")
+		}
+		fmt.Printf("\n>> Adding recipient '%s'...\n", args[1])
+		err := f.AddRecipient(s.GetSecret(), args[1], args[2])
+		if err != nil {
+			fmt.Printf("Error adding recipient, no configuration was changed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("\t> Recipient '%s' added\n", args[1])
+
+	case "remove":
+		if len(args) != 2 {
+			panic("Usage: recipients remove <name>")
+		}
+		fmt.Printf("\n>> Removing recipient '%s'...\n", args[1])
+		err := f.RemoveRecipient(s.GetSecret(), args[1])
+		if err != nil {
+			fmt.Printf("Error removing recipient, no configuration was changed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("\t> Recipient '%s' removed\n", args[1])
+
+	default:
+		panic("Invalid recipients command. Valid commands are list, add and remove")
+	}
 }
@@ -0,0 +1,59 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Prefix of the temporary files written next to their target
+const TEMP_PREFIX = ".tmp-"
+
+// WriteFileAtomic writes data to a temporary file in the same directory,
+// syncs it and renames it over path. Readers see either the old or the
+// new content, never a truncated file, even if the process dies midway.
+// An existing file keeps its mode, a new one is created with perm
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, TEMP_PREFIX+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	// CreateTemp uses 0600, the umask does not apply to Chmod
+	err = tmp.Chmod(perm)
+	if err == nil {
+		_, err = tmp.Write(data)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	syncDir(dir)
+	return nil
+}
+
+// syncDir makes a rename in dir durable. Not every platform can sync a
+// directory, so errors are ignored
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
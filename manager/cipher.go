@@ -0,0 +1,90 @@
+package manager
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+)
+
+// sealGCM encrypts plaintext with AES-GCM and returns nonce || ciphertext
+func sealGCM(key []byte, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// openGCM decrypts data produced by sealGCM. Authentication failures are
+// reported as errWrongKeyOrCorrupt, callers that know more refine it
+func openGCM(key []byte, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, badKeyError(err.Error())
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize()+gcm.Overhead() {
+		return nil, corruptFileError("ciphertext too short")
+	}
+
+	nonce := data[:gcm.NonceSize()]
+	plaintext, err := gcm.Open(nil, nonce, data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errWrongKeyOrCorrupt
+	}
+
+	return plaintext, nil
+}
+
+// openLegacyCFB decrypts files written before the versioned format existed.
+// CFB is not authenticated, so a wrong key or a modified file cannot be detected
+func openLegacyCFB(key []byte, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, badKeyError(err.Error())
+	}
+
+	if len(data) < aes.BlockSize {
+		return nil, corruptFileError("ciphertext too short")
+	}
+
+	iv := data[:aes.BlockSize]
+	plaintext := make([]byte, len(data)-aes.BlockSize)
+
+	stream := cipher.NewCFBDecrypter(block, iv)
+	stream.XORKeyStream(plaintext, data[aes.BlockSize:])
+
+	return plaintext, nil
+}
+
+// scrypt parameters used to derive the encryption key from the secret
+const SCRYPT_N = 1 << 15
+const SCRYPT_R = 8
+const SCRYPT_P = 1
+const SALT_SIZE = 16
+const KEY_SIZE = 32
+
+// newSalt returns a random salt for a new file
+func newSalt() ([]byte, error) {
+	salt := make([]byte, SALT_SIZE)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
@@ -0,0 +1,157 @@
+package manager
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+const TEST_SECRET = "488c447d4919b142c80c82832cef7f18"
+
+// Encrypt the content the way files were saved before the versioned format
+func encryptLegacyCFB(key string, content string) string {
+	block, err := aes.NewCipher([]byte(key))
+	if err != nil {
+		panic(err)
+	}
+
+	plaintext := []byte(content)
+	ciphertext := make([]byte, aes.BlockSize+len(plaintext))
+	iv := ciphertext[:aes.BlockSize]
+	if _, err = rand.Read(iv); err != nil {
+		panic(err)
+	}
+
+	stream := cipher.NewCFBEncrypter(block, iv)
+	stream.XORKeyStream(ciphertext[aes.BlockSize:], plaintext)
+
+	return hex.EncodeToString(ciphertext)
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	content := getEnvFileContent("test", "HELLO=WORLD")
+	e := &EnvFile{fileContent: content}
+	e.encrypt(TEST_SECRET, nil)
+
+	restored := &EnvFile{encrypted: e.encrypted}
+	if err := restored.decrypt(TEST_SECRET); err != nil {
+		t.Fatalf("decrypt() = %v, want %v", err, nil)
+	}
+
+	if restored.fileContent != content {
+		t.Errorf("decrypt() = %v, want %v", restored.fileContent, content)
+	}
+}
+
+func TestDecryptWrongSecret(t *testing.T) {
+	e := &EnvFile{fileContent: getEnvFileContent("test", "HELLO=WORLD")}
+	e.encrypt(TEST_SECRET, nil)
+
+	restored := &EnvFile{encrypted: e.encrypted}
+	err := restored.decrypt("00000000000000000000000000000000")
+	if !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("decrypt() = %v, want %v", err, ErrDecryptionFailed)
+	}
+	if !errors.Is(err, ErrBadKey) {
+		t.Errorf("decrypt() = %v, want %v", err, ErrBadKey)
+	}
+
+	if restored.fileContent != "" {
+		t.Errorf("decrypt() content = %v, want %v", restored.fileContent, "")
+	}
+}
+
+func TestDecryptTamperedFile(t *testing.T) {
+	e := &EnvFile{fileContent: getEnvFileContent("test", "HELLO=WORLD")}
+	e.encrypt(TEST_SECRET, nil)
+
+	// Flip the last hex digit of the ciphertext
+	tampered := []byte(e.encrypted)
+	last := len(tampered) - 1
+	if tampered[last] == '0' {
+		tampered[last] = '1'
+	} else {
+		tampered[last] = '0'
+	}
+
+	restored := &EnvFile{encrypted: string(tampered)}
+	err := restored.decrypt(TEST_SECRET)
+	if !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("decrypt() = %v, want %v", err, ErrDecryptionFailed)
+	}
+	if !errors.Is(err, ErrCorruptFile) {
+		t.Errorf("decrypt() = %v, want %v", err, ErrCorruptFile)
+	}
+}
+
+func TestDecryptTamperedCiphertext(t *testing.T) {
+	e := &EnvFile{fileContent: getEnvFileContent("test", "HELLO=WORLD")}
+	if err := e.encrypt(TEST_SECRET, nil); err != nil {
+		t.Fatalf("encrypt() = %v, want %v", err, nil)
+	}
+
+	// A valid envelope whose ciphertext has been modified
+	env := *e.envelope
+	env.Ciphertext = append([]byte(nil), env.Ciphertext...)
+	env.Ciphertext[len(env.Ciphertext)-1] ^= 1
+
+	err := (&EnvFile{envelope: &env}).decrypt(TEST_SECRET)
+	if !errors.Is(err, ErrCorruptFile) {
+		t.Errorf("decrypt() = %v, want %v", err, ErrCorruptFile)
+	}
+	if errors.Is(err, ErrBadKey) {
+		t.Errorf("decrypt() = %v, do not want %v", err, ErrBadKey)
+	}
+}
+
+func TestDecryptLegacyFile(t *testing.T) {
+	content := getEnvFileContent("legacy", "HELLO=WORLD")
+	legacy := &EnvFile{encrypted: encryptLegacyCFB(TEST_SECRET, content)}
+
+	if err := legacy.decrypt(TEST_SECRET); err != nil {
+		t.Fatalf("decrypt() = %v, want %v", err, nil)
+	}
+
+	if legacy.fileContent != content {
+		t.Errorf("decrypt() = %v, want %v", legacy.fileContent, content)
+	}
+}
+
+func TestDecryptUnsupportedVersion(t *testing.T) {
+	e := &EnvFile{encrypted: `{"format": "env-manager", "version": 99, "cipher": "aes-gcm"}`}
+	err := e.decrypt(TEST_SECRET)
+	if !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("decrypt() = %v, want %v", err, ErrUnsupportedFormat)
+	}
+}
+
+func TestEncryptDecryptPassphrase(t *testing.T) {
+	content := getEnvFileContent("test", "HELLO=WORLD")
+	for _, passphrase := range []string{"x", "correct horse battery staple", TEST_SECRET + TEST_SECRET + "!"} {
+		e := &EnvFile{fileContent: content}
+		e.encrypt(passphrase, nil)
+
+		restored := &EnvFile{encrypted: e.encrypted}
+		if err := restored.decrypt(passphrase); err != nil {
+			t.Fatalf("decrypt(%q) = %v, want %v", passphrase, err, nil)
+		}
+
+		if restored.fileContent != content {
+			t.Errorf("decrypt(%q) = %v, want %v", passphrase, restored.fileContent, content)
+		}
+	}
+}
+
+func TestEncryptUsesPerFileSalt(t *testing.T) {
+	first := &EnvFile{fileContent: "HELLO=WORLD\n"}
+	first.encrypt(TEST_SECRET, nil)
+	second := &EnvFile{fileContent: "HELLO=WORLD\n"}
+	second.encrypt(TEST_SECRET, nil)
+
+	if first.encrypted == second.encrypted {
+		t.Errorf("encrypt() produced the same output twice: %v", first.encrypted)
+	}
+}
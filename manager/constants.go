@@ -12,3 +12,7 @@ const DEFAULT_RESTORE_AS = ".env"
 // Header identifier prefix
 const IDENTIFIER_HEADER = "#- identifier: "
 const RESTORE_AS_HEADER = "#- restore-as: "
+
+// Name and current version of the encrypted file envelope
+const FORMAT_NAME = "env-manager"
+const FORMAT_VERSION = 1
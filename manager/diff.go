@@ -0,0 +1,66 @@
+package manager
+
+import "strings"
+
+// Kinds of change between two configurations
+const VARIABLE_ADDED = "added"
+const VARIABLE_REMOVED = "removed"
+const VARIABLE_CHANGED = "changed"
+
+// Shown instead of a value when values are masked
+const MASK = "********"
+
+// VariableChange is a variable that differs between two configurations
+type VariableChange struct {
+	Key  string
+	Kind string
+	Old  string // Empty when the variable was added
+	New  string // Empty when the variable was removed
+}
+
+// DiffVariables compares two configurations. Changes are ordered like the
+// variables of from, followed by the variables only in to.
+func DiffVariables(from *Dotenv, to *Dotenv) []VariableChange {
+	var changes []VariableChange
+
+	for _, key := range from.Keys() {
+		oldValue, _ := from.Get(key)
+		newValue, ok := to.Get(key)
+		if !ok {
+			changes = append(changes, VariableChange{Key: key, Kind: VARIABLE_REMOVED, Old: oldValue})
+		} else if oldValue != newValue {
+			changes = append(changes, VariableChange{Key: key, Kind: VARIABLE_CHANGED, Old: oldValue, New: newValue})
+		}
+	}
+
+	for _, key := range to.Keys() {
+		if _, ok := from.Get(key); !ok {
+			newValue, _ := to.Get(key)
+			changes = append(changes, VariableChange{Key: key, Kind: VARIABLE_ADDED, New: newValue})
+		}
+	}
+
+	return changes
+}
+
+// String renders the change on one line, with values masked unless
+// showValues is set
+func (c VariableChange) String(showValues bool) string {
+	show := func(value string) string {
+		if showValues {
+			return quoteDotenvValue(value, 0)
+		}
+		return MASK
+	}
+
+	var b strings.Builder
+	switch c.Kind {
+	case VARIABLE_ADDED:
+		b.WriteString("+ " + c.Key + "=" + show(c.New))
+	case VARIABLE_REMOVED:
+		b.WriteString("- " + c.Key + "=" + show(c.Old))
+	case VARIABLE_CHANGED:
+		b.WriteString("~ " + c.Key + ": " + show(c.Old) + " -> " + show(c.New))
+	}
+	return b.String()
+}
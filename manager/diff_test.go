@@ -0,0 +1,37 @@
+package manager
+
+import "testing"
+
+func TestDiffVariables(t *testing.T) {
+	from, _ := ParseDotenv("# staging\nKEEP=same\nCHANGE=old\nREMOVE=gone\n")
+	to, _ := ParseDotenv("export KEEP=same\nADD=new value\nCHANGE=new\n")
+
+	changes := DiffVariables(from, to)
+	want := []VariableChange{
+		{Key: "CHANGE", Kind: VARIABLE_CHANGED, Old: "old", New: "new"},
+		{Key: "REMOVE", Kind: VARIABLE_REMOVED, Old: "gone"},
+		{Key: "ADD", Kind: VARIABLE_ADDED, New: "new value"},
+	}
+
+	if len(changes) != len(want) {
+		t.Fatalf("DiffVariables() = %v, want %v", changes, want)
+	}
+
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("DiffVariables()[%d] = %v, want %v", i, changes[i], want[i])
+		}
+	}
+
+	if got := changes[0].String(false); got != "~ CHANGE: "+MASK+" -> "+MASK {
+		t.Errorf("String(false) = %v", got)
+	}
+
+	if got := changes[2].String(true); got != `+ ADD="new value"` {
+		t.Errorf("String(true) = %v", got)
+	}
+
+	if len(DiffVariables(from, from)) != 0 {
+		t.Errorf("DiffVariables() of the same configuration is not empty")
+	}
+}
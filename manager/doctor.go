@@ -0,0 +1,235 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Kinds of problems reported by Check
+const (
+	PROBLEM_ORPHAN      = "orphan"      // Encrypted file missing from the manifest
+	PROBLEM_DANGLING    = "dangling"    // Manifest entry without encrypted file
+	PROBLEM_LEFTOVER    = "leftover"    // Temporary file of an interrupted write or rotation
+	PROBLEM_CORRUPT     = "corrupt"     // Unreadable or damaged encrypted file
+	PROBLEM_CHECKSUM    = "checksum"    // Encrypted file changed outside env-manager
+	PROBLEM_DECRYPT     = "decrypt"     // The secret does not open the file
+	PROBLEM_PERMISSIONS = "permissions" // Secret file readable by other users
+)
+
+// Permissions the secret file should have
+const SECRET_FILE_MODE = 0600
+
+// Problem is an inconsistency found in a folder or its secret file
+type Problem struct {
+	Kind       string
+	Identifier string // Configuration concerned, if any
+	File       string // Name in the store, or path of the secret file
+	Detail     string
+	Fixable    bool
+}
+
+func (p Problem) String() string {
+	subject := p.Identifier
+	if subject == "" {
+		subject = p.File
+	}
+	return fmt.Sprintf("%s: %s: %s", p.Kind, subject, p.Detail)
+}
+
+/// Functions
+
+// Check compares the manifest with the files of the store and tries to
+// open every configuration. Without secret files are only decoded
+func (f *Folder) Check(secret string) ([]Problem, error) {
+	names, err := f.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	stored := make(map[string]bool)
+	var problems []Problem
+	for _, name := range names {
+		switch {
+		case strings.HasPrefix(path.Base(name), TEMP_PREFIX):
+			problems = append(problems, Problem{
+				Kind: PROBLEM_LEFTOVER, File: name, Fixable: true,
+				Detail: "temporary file of an interrupted write, remove it",
+			})
+		case strings.HasSuffix(name, ROTATE_SUFFIX):
+			problems = append(problems, Problem{
+				Kind: PROBLEM_LEFTOVER, File: name, Fixable: true,
+				Detail: "staging file of an interrupted rotation, remove it",
+			})
+		case strings.HasPrefix(name, SAVED_PREFIX):
+			stored[strings.TrimPrefix(name, SAVED_PREFIX)] = true
+		}
+	}
+
+	for _, id := range f.Identifiers() {
+		name := storedName(id)
+		if !stored[id] {
+			problems = append(problems, Problem{
+				Kind: PROBLEM_DANGLING, Identifier: id, File: name, Fixable: true,
+				Detail: fmt.Sprintf("%s is missing, remove the entry from %s", name, MANIFEST_FILE),
+			})
+			continue
+		}
+
+		entry, _ := f.Entry(id)
+		problems = append(problems, f.checkFile(id, entry.Checksum, secret)...)
+	}
+
+	for _, id := range sortedKeys(stored) {
+		if f.hasIdentifier(id) {
+			continue
+		}
+
+		problem := Problem{Kind: PROBLEM_ORPHAN, Identifier: id, File: storedName(id)}
+		if found := f.checkFile(id, "", secret); len(found) > 0 {
+			problem.Detail = fmt.Sprintf("not in %s and cannot be opened", MANIFEST_FILE)
+			problems = append(problems, problem)
+			problems = append(problems, found...)
+			continue
+		}
+		problem.Fixable = true
+		problem.Detail = fmt.Sprintf("not in %s, add it back", MANIFEST_FILE)
+		problems = append(problems, problem)
+	}
+
+	return problems, nil
+}
+
+// checkFile reads and opens one encrypted file. An empty checksum is not
+// compared
+func (f *Folder) checkFile(id string, sum string, secret string) []Problem {
+	name := storedName(id)
+	content, err := f.store.ReadFile(name)
+	if err != nil {
+		return []Problem{{Kind: PROBLEM_CORRUPT, Identifier: id, File: name, Detail: err.Error()}}
+	}
+
+	if _, err := DecodeEnvelope(string(content)); err != nil {
+		return []Problem{{Kind: PROBLEM_CORRUPT, Identifier: id, File: name, Detail: err.Error()}}
+	}
+
+	var problems []Problem
+	decrypted := false
+	if secret != "" {
+		err := DecryptEnvFile(newStoredEnvFile(f, id, string(content)), secret)
+		switch {
+		case errors.Is(err, ErrCorruptFile):
+			return []Problem{{Kind: PROBLEM_CORRUPT, Identifier: id, File: name, Detail: err.Error()}}
+		case err != nil:
+			problems = append(problems, Problem{Kind: PROBLEM_DECRYPT, Identifier: id, File: name, Detail: err.Error()})
+		default:
+			decrypted = true
+		}
+	}
+
+	if sum != "" && sum != checksum(content) {
+		problem := Problem{Kind: PROBLEM_CHECKSUM, Identifier: id, File: name, Fixable: decrypted}
+		if decrypted {
+			problem.Detail = fmt.Sprintf("%s was changed outside env-manager but decrypts, record its new checksum", name)
+		} else {
+			problem.Detail = fmt.Sprintf("%s does not match the checksum in %s", name, MANIFEST_FILE)
+		}
+		problems = append(problems, problem)
+	}
+
+	return problems
+}
+
+// Fix repairs a fixable problem: orphans are added back to the manifest,
+// dangling entries are removed, leftovers are deleted, checksums recorded
+// again and the secret file made private. secret is used to read the
+// restore-as of an orphan
+func (f *Folder) Fix(p Problem, secret string) error {
+	if !p.Fixable {
+		return fmt.Errorf("%s cannot be fixed automatically", p)
+	}
+
+	switch p.Kind {
+	case PROBLEM_ORPHAN, PROBLEM_CHECKSUM:
+		return f.reindex(p.Identifier, secret)
+
+	case PROBLEM_DANGLING:
+		return f.updateManifest(func(m *Manifest) {
+			delete(m.Entries, EnvFileIdentifier(p.Identifier))
+		})
+
+	case PROBLEM_LEFTOVER:
+		err := f.store.Remove(p.File)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+
+	case PROBLEM_PERMISSIONS:
+		return os.Chmod(p.File, SECRET_FILE_MODE)
+
+	default:
+		return fmt.Errorf("unknown problem %s", p.Kind)
+	}
+}
+
+// reindex records an encrypted file in the manifest as if it was just
+// saved. The restore-as is only known when secret opens it
+func (f *Folder) reindex(id string, secret string) error {
+	content, err := f.store.ReadFile(storedName(id))
+	if err != nil {
+		return err
+	}
+
+	e := newStoredEnvFile(f, id, string(content))
+	if e.envelope == nil {
+		return fmt.Errorf("%w: %s", ErrCorruptFile, storedName(id))
+	}
+	restoreAs := ""
+	if secret != "" && DecryptEnvFile(e, secret) == nil {
+		restoreAs = e.header.RestoreAs
+	}
+
+	return f.updateManifest(func(m *Manifest) {
+		entry := m.entry(EnvFileIdentifier(id))
+		if restoreAs != "" {
+			entry.RestoreAs = restoreAs
+		}
+		entry.Checksum = checksum(content)
+		entry.CreatedAt = e.envelope.CreatedAt
+		entry.UpdatedAt = e.envelope.UpdatedAt
+	})
+}
+
+// CheckSecretFile reports a .secret file in dir that other users can
+// read. A missing file is not a problem, the secret may come from the
+// environment
+func CheckSecretFile(dir string) *Problem {
+	path := filepath.Join(dir, DOT_SECRET)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+
+	if mode := info.Mode().Perm(); mode&0077 != 0 {
+		return &Problem{
+			Kind: PROBLEM_PERMISSIONS, File: path, Fixable: true,
+			Detail: fmt.Sprintf("mode is %04o, other users can read it; it should be %04o", mode, SECRET_FILE_MODE),
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
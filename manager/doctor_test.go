@@ -0,0 +1,98 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// problemKinds renders the kind and subject of each problem
+func problemKinds(problems []Problem) string {
+	var kinds []string
+	for _, p := range problems {
+		subject := p.Identifier
+		if subject == "" {
+			subject = p.File
+		}
+		kinds = append(kinds, p.Kind+" "+subject)
+	}
+	return strings.Join(kinds, ", ")
+}
+
+func TestCheckAndFix(t *testing.T) {
+	f := newTestFolder(t)
+	for _, id := range []string{"dangling", "orphan", "edited", "other", "corrupt"} {
+		saveTestEnvFile(t, f, id, TEST_SECRET, "A=1\n")
+	}
+	store := f.Store()
+
+	if problems, err := f.Check(TEST_SECRET); err != nil || len(problems) != 0 {
+		t.Fatalf("Check() = %v, %v, want no problems", problems, err)
+	}
+
+	store.Remove(storedName("dangling"))
+	f.updateManifest(func(m *Manifest) { delete(m.Entries, "orphan") })
+	store.WriteFile(storedName("corrupt"), []byte("not an envelope"))
+	store.WriteFile(storedName("x")+ROTATE_SUFFIX, []byte("staged"))
+	store.WriteFile(TEMP_PREFIX+MANIFEST_FILE+"-123", []byte("{"))
+
+	// Re-encrypted outside env-manager, with the same or another secret
+	for id, secret := range map[string]string{"edited": TEST_SECRET, "other": ROTATED_SECRET} {
+		e := InitEnvFile(id, DEFAULT_RESTORE_AS)
+		e.SetContent("A=2\n")
+		e.encrypt(secret, nil)
+		store.WriteFile(storedName(id), []byte(e.encrypted))
+	}
+
+	problems, err := f.Check(TEST_SECRET)
+	if err != nil {
+		t.Fatalf("Check() = %v, want %v", err, nil)
+	}
+	want := "leftover .env.x.rotate, leftover .tmp-manifest.json-123, corrupt corrupt, dangling dangling, checksum edited, decrypt other, checksum other, orphan orphan"
+	if got := problemKinds(problems); got != want {
+		t.Errorf("Check() = %s, want %s", got, want)
+	}
+
+	for _, p := range problems {
+		if p.Fixable {
+			if err := f.Fix(p, TEST_SECRET); err != nil {
+				t.Errorf("Fix(%s) = %v, want %v", p, err, nil)
+			}
+		} else if err := f.Fix(p, TEST_SECRET); err == nil {
+			t.Errorf("Fix(%s) = %v, want an error", p, err)
+		}
+	}
+
+	problems, _ = f.Check(TEST_SECRET)
+	if got, want := problemKinds(problems), "corrupt corrupt, decrypt other, checksum other"; got != want {
+		t.Errorf("Check() after Fix() = %s, want %s", got, want)
+	}
+	if entry, ok := f.Entry("orphan"); !ok || entry.RestoreAs != DEFAULT_RESTORE_AS {
+		t.Errorf("Entry() of the fixed orphan = %+v, %v, want it indexed", entry, ok)
+	}
+}
+
+func TestCheckSecretFile(t *testing.T) {
+	dir := t.TempDir()
+	if p := CheckSecretFile(dir); p != nil {
+		t.Errorf("CheckSecretFile() without file = %v, want %v", p, nil)
+	}
+
+	path := filepath.Join(dir, DOT_SECRET)
+	os.WriteFile(path, []byte(TEST_SECRET), 0644)
+	os.Chmod(path, 0644)
+
+	p := CheckSecretFile(dir)
+	if p == nil || p.Kind != PROBLEM_PERMISSIONS {
+		t.Fatalf("CheckSecretFile() = %v, want a %s problem", p, PROBLEM_PERMISSIONS)
+	}
+
+	f := newTestFolder(t)
+	if err := f.Fix(*p, ""); err != nil {
+		t.Fatalf("Fix() = %v, want %v", err, nil)
+	}
+	if p := CheckSecretFile(dir); p != nil {
+		t.Errorf("CheckSecretFile() after Fix() = %v, want %v", p, nil)
+	}
+}
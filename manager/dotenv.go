@@ -0,0 +1,331 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DotenvEntry is one entry of a dotenv file: a variable, a comment line
+// or a blank line. Comments and blank lines have an empty Key.
+type DotenvEntry struct {
+	Key     string
+	Value   string // Decoded value, without quotes and escapes
+	Export  bool   // Declared with the `export` prefix
+	Quote   byte   // Quote used in the source: 0, '\'', '"' or '`'
+	Comment string // Inline comment of a variable or the text of a comment line
+	raw     string // Exact source text, including the line break
+}
+
+// Dotenv is an ordered key/value model of a dotenv file. Entries keep their
+// source text, so an unchanged file renders back byte for byte.
+type Dotenv struct {
+	entries []*DotenvEntry
+}
+
+// ParseDotenv parses the content of a dotenv file. It supports single,
+// double and backtick quoted values, multi-line quoted values, the
+// `export` prefix, escapes in double quotes and inline comments.
+func ParseDotenv(content string) (*Dotenv, error) {
+	d := &Dotenv{}
+	line := 1
+
+	for pos := 0; pos < len(content); {
+		entry, end, err := parseDotenvEntry(content, pos)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		entry.raw = content[pos:end]
+		d.entries = append(d.entries, entry)
+
+		line += strings.Count(entry.raw, "\n")
+		pos = end
+	}
+
+	return d, nil
+}
+
+// lineEnd returns the index after the line break of the line containing pos
+func lineEnd(s string, pos int) int {
+	if i := strings.IndexByte(s[pos:], '\n'); i >= 0 {
+		return pos + i + 1
+	}
+	return len(s)
+}
+
+func isKeyChar(c byte) bool {
+	return c == '_' || c == '.' || c == '-' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func skipBlanks(s string, pos int) int {
+	for pos < len(s) && (s[pos] == ' ' || s[pos] == '\t') {
+		pos++
+	}
+	return pos
+}
+
+func parseDotenvEntry(s string, start int) (*DotenvEntry, int, error) {
+	end := lineEnd(s, start)
+	text := strings.TrimRight(s[start:end], "\r\n")
+	trimmed := strings.TrimSpace(text)
+
+	if trimmed == "" {
+		return &DotenvEntry{}, end, nil
+	}
+
+	if trimmed[0] == '#' {
+		return &DotenvEntry{Comment: trimmed}, end, nil
+	}
+
+	entry := &DotenvEntry{}
+	pos := skipBlanks(s, start)
+
+	if strings.HasPrefix(s[pos:], "export ") || strings.HasPrefix(s[pos:], "export\t") {
+		entry.Export = true
+		pos = skipBlanks(s, pos+len("export"))
+	}
+
+	keyStart := pos
+	for pos < len(s) && isKeyChar(s[pos]) {
+		pos++
+	}
+	entry.Key = s[keyStart:pos]
+
+	if entry.Key == "" || (entry.Key[0] >= '0' && entry.Key[0] <= '9') {
+		return nil, 0, fmt.Errorf("invalid variable name in %q", trimmed)
+	}
+
+	pos = skipBlanks(s, pos)
+	if pos >= len(s) || s[pos] != '=' {
+		return nil, 0, fmt.Errorf("expected '=' after %s", entry.Key)
+	}
+	pos = skipBlanks(s, pos+1)
+
+	if pos < len(s) && (s[pos] == '"' || s[pos] == '\'' || s[pos] == '`') {
+		return parseQuotedValue(s, pos, entry)
+	}
+
+	end = lineEnd(s, pos)
+	value := strings.TrimRight(s[pos:end], "\r\n")
+
+	// An unquoted value ends at a '#' that starts it or follows a blank
+	for i := 0; i < len(value); i++ {
+		if value[i] == '#' && (i == 0 || value[i-1] == ' ' || value[i-1] == '\t') {
+			entry.Comment = strings.TrimSpace(value[i:])
+			value = value[:i]
+			break
+		}
+	}
+
+	entry.Value = strings.TrimSpace(value)
+	return entry, end, nil
+}
+
+func parseQuotedValue(s string, pos int, entry *DotenvEntry) (*DotenvEntry, int, error) {
+	quote := s[pos]
+	entry.Quote = quote
+
+	var b strings.Builder
+	i := pos + 1
+	for ; i < len(s) && s[i] != quote; i++ {
+		if quote == '"' && s[i] == '\\' && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '\\', '"', '$':
+				b.WriteByte(s[i])
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(s[i])
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+
+	if i >= len(s) {
+		return nil, 0, fmt.Errorf("unterminated quoted value for %s", entry.Key)
+	}
+	entry.Value = b.String()
+
+	end := lineEnd(s, i)
+	rest := strings.TrimSpace(strings.TrimRight(s[i+1:end], "\r\n"))
+	if rest != "" {
+		if rest[0] != '#' {
+			return nil, 0, fmt.Errorf("unexpected characters after the value of %s", entry.Key)
+		}
+		entry.Comment = rest
+	}
+
+	return entry, end, nil
+}
+
+// String renders the dotenv file. Entries that were not changed keep
+// their exact source text.
+func (d *Dotenv) String() string {
+	var b strings.Builder
+	for _, e := range d.entries {
+		b.WriteString(e.raw)
+	}
+	return b.String()
+}
+
+// Entries returns every entry, including comments and blank lines, in order
+func (d *Dotenv) Entries() []*DotenvEntry {
+	return d.entries
+}
+
+// Keys returns the variable names in order of first appearance
+func (d *Dotenv) Keys() []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, e := range d.entries {
+		if e.Key != "" && !seen[e.Key] {
+			seen[e.Key] = true
+			keys = append(keys, e.Key)
+		}
+	}
+	return keys
+}
+
+// Get returns the value of a variable. When a key is declared more than
+// once the last declaration wins, like when the file is sourced
+func (d *Dotenv) Get(key string) (string, bool) {
+	if e := d.lookup(key); e != nil {
+		return e.Value, true
+	}
+	return "", false
+}
+
+// Map returns the variables as a map
+func (d *Dotenv) Map() map[string]string {
+	m := make(map[string]string)
+	for _, e := range d.entries {
+		if e.Key != "" {
+			m[e.Key] = e.Value
+		}
+	}
+	return m
+}
+
+func (d *Dotenv) lookup(key string) *DotenvEntry {
+	for i := len(d.entries) - 1; i >= 0; i-- {
+		if d.entries[i].Key == key {
+			return d.entries[i]
+		}
+	}
+	return nil
+}
+
+// ValidateKey checks that key can be used as a variable name
+func ValidateKey(key string) error {
+	if key == "" {
+		return errors.New("variable name is empty")
+	}
+	if key[0] >= '0' && key[0] <= '9' {
+		return fmt.Errorf("invalid variable name %q: starts with a digit", key)
+	}
+	for i := 0; i < len(key); i++ {
+		if !isKeyChar(key[i]) {
+			return fmt.Errorf("invalid variable name %q", key)
+		}
+	}
+	return nil
+}
+
+// Set changes the value of a variable, keeping its position, export prefix
+// and inline comment. A new variable is appended at the end.
+func (d *Dotenv) Set(key string, value string) error {
+	if err := ValidateKey(key); err != nil {
+		return err
+	}
+
+	if e := d.lookup(key); e != nil {
+		if e.Value == value {
+			return nil
+		}
+		e.Value = value
+		e.render()
+		return nil
+	}
+
+	// Make sure the new entry starts on its own line
+	if n := len(d.entries); n > 0 && !strings.HasSuffix(d.entries[n-1].raw, "\n") {
+		d.entries[n-1].raw += "\n"
+	}
+
+	e := &DotenvEntry{Key: key, Value: value}
+	e.render()
+	d.entries = append(d.entries, e)
+	return nil
+}
+
+// Unset removes every declaration of a variable and reports whether
+// the variable existed
+func (d *Dotenv) Unset(key string) bool {
+	var kept []*DotenvEntry
+	for _, e := range d.entries {
+		if e.Key != key {
+			kept = append(kept, e)
+		}
+	}
+
+	removed := len(kept) != len(d.entries)
+	d.entries = kept
+	return removed
+}
+
+// render rebuilds the source text of a changed variable
+func (e *DotenvEntry) render() {
+	var b strings.Builder
+	if e.Export {
+		b.WriteString("export ")
+	}
+	b.WriteString(e.Key)
+	b.WriteByte('=')
+	b.WriteString(quoteDotenvValue(e.Value, e.Quote))
+	if e.Comment != "" {
+		b.WriteByte(' ')
+		b.WriteString(e.Comment)
+	}
+	b.WriteByte('\n')
+	e.raw = b.String()
+}
+
+// isBareValue reports whether the value can be written without quotes
+func isBareValue(value string) bool {
+	return !strings.ContainsAny(value, " \t\r\n#'\"`\\")
+}
+
+// quoteDotenvValue renders a value, keeping the preferred quote style
+// when it can represent the value
+func quoteDotenvValue(value string, preferred byte) string {
+	if preferred == '\'' && !strings.ContainsAny(value, "'\n\r") {
+		return "'" + value + "'"
+	}
+
+	if preferred != '"' && isBareValue(value) {
+		return value
+	}
+
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`)
+	return `"` + r.Replace(value) + `"`
+}
+
+// Variables parses the decrypted content of the environment file
+func (e *EnvFile) Variables() (*Dotenv, error) {
+	return ParseDotenv(e.fileContent)
+}
+
+// SetVariables replaces the content of the environment file with the
+// rendered variables. Header lines are comments, so they are kept as is.
+func (e *EnvFile) SetVariables(d *Dotenv) {
+	e.fileContent = d.String()
+}
@@ -0,0 +1,172 @@
+package manager
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+const DOTENV_FIXTURE = `#- identifier: test
+#- restore-as: .env
+
+# Database
+DB_HOST=localhost
+DB_PORT = 5432 # default port
+export API_KEY="sk_live_\"quoted\"\n"
+  PASSWORD='p@ss#word'
+PRIVATE_KEY="-----BEGIN KEY-----
+abc
+-----END KEY-----"
+RAW=` + "`literal \\n`" + `
+EMPTY=
+URL=https://example.com/#anchor
+WINDOWS=crlf` + "\r\n" + `LAST=no-newline`
+
+func TestParseDotenv(t *testing.T) {
+	d, err := ParseDotenv(DOTENV_FIXTURE)
+	if err != nil {
+		t.Fatalf("ParseDotenv() = %v, want %v", err, nil)
+	}
+
+	want := map[string]string{
+		"DB_HOST":     "localhost",
+		"DB_PORT":     "5432",
+		"API_KEY":     "sk_live_\"quoted\"\n",
+		"PASSWORD":    "p@ss#word",
+		"PRIVATE_KEY": "-----BEGIN KEY-----\nabc\n-----END KEY-----",
+		"RAW":         `literal \n`,
+		"EMPTY":       "",
+		"URL":         "https://example.com/#anchor",
+		"WINDOWS":     "crlf",
+		"LAST":        "no-newline",
+	}
+
+	got := d.Map()
+	if len(got) != len(want) {
+		t.Errorf("ParseDotenv() found %d variables, want %d: %v", len(got), len(want), d.Keys())
+	}
+
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("ParseDotenv() %s = %q, want %q", key, got[key], value)
+		}
+	}
+
+	wantKeys := []string{"DB_HOST", "DB_PORT", "API_KEY", "PASSWORD", "PRIVATE_KEY", "RAW", "EMPTY", "URL", "WINDOWS", "LAST"}
+	for i, key := range d.Keys() {
+		if key != wantKeys[i] {
+			t.Errorf("Keys()[%d] = %v, want %v", i, key, wantKeys[i])
+		}
+	}
+
+	for _, e := range d.Entries() {
+		if e.Key == "API_KEY" && !e.Export {
+			t.Errorf("ParseDotenv() API_KEY export = %v, want %v", e.Export, true)
+		}
+		if e.Key == "DB_PORT" && e.Comment != "# default port" {
+			t.Errorf("ParseDotenv() DB_PORT comment = %q, want %q", e.Comment, "# default port")
+		}
+	}
+
+	if d.String() != DOTENV_FIXTURE {
+		t.Errorf("String() = %q, want %q", d.String(), DOTENV_FIXTURE)
+	}
+}
+
+func TestParseDotenvErrors(t *testing.T) {
+	tests := []string{
+		"NO_EQUALS\n",
+		"1KEY=value\n",
+		"KEY=\"unterminated\n",
+		"KEY='value' trailing\n",
+	}
+
+	for _, content := range tests {
+		if _, err := ParseDotenv(content); err == nil {
+			t.Errorf("ParseDotenv(%q) = %v, want error", content, err)
+		}
+	}
+}
+
+func TestDotenvSetUnset(t *testing.T) {
+	d, err := ParseDotenv(DOTENV_FIXTURE)
+	if err != nil {
+		t.Fatalf("ParseDotenv() = %v, want %v", err, nil)
+	}
+
+	d.Set("DB_PORT", "6543")
+	d.Set("PASSWORD", "new pass")
+	d.Set("API_KEY", "plain")
+	d.Set("NEW_KEY", "has space")
+	d.Unset("RAW")
+
+	if err := d.Set("BAD KEY", "value"); err == nil {
+		t.Errorf("Set() accepted an invalid key")
+	}
+
+	want := `#- identifier: test
+#- restore-as: .env
+
+# Database
+DB_HOST=localhost
+DB_PORT=6543 # default port
+export API_KEY="plain"
+PASSWORD='new pass'
+PRIVATE_KEY="-----BEGIN KEY-----
+abc
+-----END KEY-----"
+EMPTY=
+URL=https://example.com/#anchor
+WINDOWS=crlf` + "\r\n" + `LAST=no-newline
+NEW_KEY="has space"
+`
+
+	if d.String() != want {
+		t.Errorf("String() = %q, want %q", d.String(), want)
+	}
+
+	// The rendered file parses back to the same values
+	reparsed, err := ParseDotenv(d.String())
+	if err != nil {
+		t.Fatalf("ParseDotenv() = %v, want %v", err, nil)
+	}
+
+	for key, value := range d.Map() {
+		if got, _ := reparsed.Get(key); got != value {
+			t.Errorf("Get(%s) = %q, want %q", key, got, value)
+		}
+	}
+}
+
+func TestDotenvRoundTripThroughRestore(t *testing.T) {
+	const RESTORE_AS = ".env-test-dotenv"
+	t.Chdir(t.TempDir())
+
+	e := InitEnvFile("dotenv", RESTORE_AS)
+	e.SetContent(strings.TrimPrefix(DOTENV_FIXTURE, "#- identifier: test\n#- restore-as: .env\n"))
+	content := e.fileContent
+
+	d, err := e.Variables()
+	if err != nil {
+		t.Fatalf("Variables() = %v, want %v", err, nil)
+	}
+	e.SetVariables(d)
+
+	if err := e.encrypt(TEST_SECRET, nil); err != nil {
+		t.Fatalf("encrypt() = %v, want %v", err, nil)
+	}
+
+	restored := &EnvFile{encrypted: e.encrypted, header: &Header{Identifier: "dotenv"}}
+	if err := RestoreEnvFile(restored, TEST_SECRET); err != nil {
+		t.Fatalf("RestoreEnvFile() = %v, want %v", err, nil)
+	}
+
+	written, err := os.ReadFile(RESTORE_AS)
+	if err != nil {
+		t.Fatalf("ReadFile() = %v, want %v", err, nil)
+	}
+
+	if string(written) != content {
+		t.Errorf("RestoreEnvFile() = %q, want %q", string(written), content)
+	}
+}
@@ -0,0 +1,130 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Memory backed folder preferred for temporary plaintext files
+const TMPFS_DIR = "/dev/shm"
+
+// Returned when an edit changes the identifier header. Renaming
+// a configuration is not supported
+var ErrIdentifierChanged = errors.New("the identifier header cannot be changed")
+
+// privateTempDir returns a tmpfs folder when one is available, so the
+// plaintext never reaches a disk, and the default temp folder otherwise
+func privateTempDir() string {
+	if info, err := os.Stat(TMPFS_DIR); err == nil && info.IsDir() {
+		if f, err := os.CreateTemp(TMPFS_DIR, ".env-manager-probe-*"); err == nil {
+			f.Close()
+			os.Remove(f.Name())
+			return TMPFS_DIR
+		}
+	}
+	return os.TempDir()
+}
+
+// secureDelete overwrites the file with zeros before removing it
+func secureDelete(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return os.Remove(path)
+	}
+
+	if info, err := f.Stat(); err == nil {
+		f.Write(make([]byte, info.Size()))
+		f.Sync()
+	}
+	f.Close()
+
+	return os.Remove(path)
+}
+
+// EditEnvFile decrypts a stored configuration into a temporary file only
+// the current user can read, calls edit with its path and saves the result
+// encrypted again. The temporary file is overwritten and removed afterwards.
+//
+// The headers must still be valid after the edit, the identifier cannot
+// change and the schema must match. Otherwise edit is called again on the
+// same file with the problem, so nothing typed is lost; it returns an error
+// to give up. If the content did not change nothing is rewritten and false
+// is returned.
+func (f *Folder) EditEnvFile(identifier string, secret string, edit func(path string, problem error) error) (bool, error) {
+	e, err := f.GetEnvFile(identifier)
+	if err != nil {
+		return false, err
+	}
+
+	if err := DecryptEnvFile(e, secret); err != nil {
+		return false, err
+	}
+
+	tmp, err := os.CreateTemp(privateTempDir(), "env-manager-*.env")
+	if err != nil {
+		return false, err
+	}
+	path := tmp.Name()
+	defer secureDelete(path)
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return false, err
+	}
+
+	_, err = tmp.WriteString(e.fileContent)
+	tmp.Close()
+	if err != nil {
+		return false, err
+	}
+
+	original := e.fileContent
+	var problem error
+	for {
+		if err := edit(path, problem); err != nil {
+			return false, err
+		}
+
+		edited, err := os.ReadFile(path)
+		if err != nil {
+			return false, err
+		}
+
+		if string(edited) == original {
+			return false, nil
+		}
+
+		problem = f.saveEdited(e, identifier, string(edited), secret)
+		if problem == nil {
+			return true, nil
+		}
+		if !errors.Is(problem, ErrHeaderMissing) && !errors.Is(problem, ErrIdentifierChanged) && !errors.Is(problem, ErrInvalidConfig) {
+			return false, problem
+		}
+	}
+}
+
+// saveEdited checks the headers of the edited content and saves it
+func (f *Folder) saveEdited(e *EnvFile, identifier string, edited string, secret string) error {
+	h, err := InitHeader(edited)
+	if err != nil {
+		return err
+	}
+
+	if h.Identifier != identifier {
+		return fmt.Errorf("%w: %s -> %s", ErrIdentifierChanged, identifier, h.Identifier)
+	}
+
+	e.header = h
+	e.fileContent = edited
+	return f.SaveEnvFile(e, secret)
+}
+
+func EditEnvFile(identifier string, secret string, folder *string, edit func(path string, problem error) error) (bool, error) {
+	f, err := GetOrCreateFolder(folder)
+	if err != nil {
+		return false, err
+	}
+	return f.EditEnvFile(identifier, secret, edit)
+}
@@ -0,0 +1,99 @@
+package manager
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestEditEnvFile(t *testing.T) {
+	f := newTestFolder(t)
+	saveTestEnvFile(t, f, "production", TEST_SECRET, "HELLO=WORLD\n")
+	stored, _ := f.Store().ReadFile(storedName("production"))
+
+	var tempPath string
+
+	// Exiting without changes does not rewrite the file
+	changed, err := f.EditEnvFile("production", TEST_SECRET, func(path string, problem error) error {
+		tempPath = path
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("EditEnvFile() temp file mode = %v, want %v", info.Mode().Perm(), os.FileMode(0600))
+		}
+		return nil
+	})
+	if err != nil || changed {
+		t.Fatalf("EditEnvFile() = %v, %v, want %v, %v", changed, err, false, nil)
+	}
+
+	if _, err := os.Stat(tempPath); !os.IsNotExist(err) {
+		t.Errorf("EditEnvFile() left the temp file %s", tempPath)
+	}
+
+	if after, _ := f.Store().ReadFile(storedName("production")); string(after) != string(stored) {
+		t.Errorf("EditEnvFile() rewrote an unchanged configuration")
+	}
+
+	// Removing the headers is refused, giving up keeps the stored file
+	_, err = f.EditEnvFile("production", TEST_SECRET, func(path string, problem error) error {
+		if problem != nil {
+			return problem
+		}
+		return os.WriteFile(path, []byte("HELLO=WORLD\n"), 0600)
+	})
+	if !errors.Is(err, ErrHeaderMissing) {
+		t.Errorf("EditEnvFile() = %v, want %v", err, ErrHeaderMissing)
+	}
+
+	// Changing the identifier is refused
+	_, err = f.EditEnvFile("production", TEST_SECRET, func(path string, problem error) error {
+		if problem != nil {
+			return problem
+		}
+		return os.WriteFile(path, []byte(getEnvFileContent("renamed", "HELLO=WORLD")), 0600)
+	})
+	if !errors.Is(err, ErrIdentifierChanged) {
+		t.Errorf("EditEnvFile() = %v, want %v", err, ErrIdentifierChanged)
+	}
+	if after, _ := f.Store().ReadFile(storedName("production")); string(after) != string(stored) {
+		t.Errorf("EditEnvFile() saved a refused edit")
+	}
+
+	// An invalid edit is reopened with what was typed
+	var calls int
+	changed, err = f.EditEnvFile("production", TEST_SECRET, func(path string, problem error) error {
+		calls++
+		content, _ := os.ReadFile(path)
+		if problem == nil {
+			return os.WriteFile(path, []byte(strings.Replace(string(content), "#- identifier: production", "#- identifier: renamed", 1)), 0600)
+		}
+		if !strings.Contains(string(content), "renamed") {
+			t.Errorf("EditEnvFile() reopened %q, want the edited content", content)
+		}
+		return os.WriteFile(path, []byte(strings.Replace(string(content), "renamed", "production", 1)), 0600)
+	})
+	if err != nil || changed || calls != 2 {
+		t.Errorf("EditEnvFile() = %v, %v after %d edits, want %v, %v after 2", changed, err, calls, false, nil)
+	}
+
+	changed, err = f.EditEnvFile("production", TEST_SECRET, func(path string, problem error) error {
+		content, _ := os.ReadFile(path)
+		return os.WriteFile(path, []byte(strings.Replace(string(content), "WORLD", "EDITOR", 1)), 0600)
+	})
+	if err != nil || !changed {
+		t.Fatalf("EditEnvFile() = %v, %v, want %v, %v", changed, err, true, nil)
+	}
+
+	e, err := decryptStored(t, f, "production", TEST_SECRET)
+	if err != nil {
+		t.Fatalf("decrypt() = %v, want %v", err, nil)
+	}
+
+	if want := getEnvFileContent("production", "HELLO=EDITOR"); e.fileContent != want {
+		t.Errorf("EditEnvFile() content = %q, want %q", e.fileContent, want)
+	}
+}
@@ -1,14 +1,11 @@
 package manager
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
-	"encoding/hex"
 	"errors"
 	"fmt"
-	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -16,11 +13,12 @@ type EnvFile struct {
 	header      *Header
 	fileContent string
 	encrypted   string
-	folderPath  string // Where the encrypted file is saved
+	envelope    *Envelope // Decoded form of encrypted
+	folder      *Folder   // Where the encrypted file is saved
 }
 
 func (e *EnvFile) RestoreAs() string {
-	return e.fileContent
+	return e.header.RestoreAs
 }
 
 func (e *EnvFile) Identifier() string {
@@ -31,6 +29,12 @@ func (e *EnvFile) IsEncrypted() bool {
 	return e.encrypted != ""
 }
 
+// Envelope returns the metadata of the saved file, or nil if the
+// file has not been saved or could not be decoded
+func (e *EnvFile) Envelope() *Envelope {
+	return e.envelope
+}
+
 func (e *EnvFile) Headers() []string {
 	return e.header.String()
 }
@@ -53,153 +57,185 @@ func (e *EnvFile) readHeader() error {
 	return nil
 }
 
-func (e *EnvFile) encrypt(key string) {
-	block, err := aes.NewCipher([]byte(key))
+func (e *EnvFile) encrypt(secret string, recipients []*Recipient) error {
+	env, err := sealEnvelope(secret, recipients, []byte(e.fileContent))
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	plaintext := []byte(e.fileContent)
-	ciphertext := make([]byte, aes.BlockSize+len(plaintext))
-	iv := ciphertext[:aes.BlockSize]
-	if _, err = rand.Read(iv); err != nil {
-		panic(err)
+	// Keep the creation time of the configuration this file replaces
+	if e.envelope != nil && !e.envelope.CreatedAt.IsZero() {
+		env.CreatedAt = e.envelope.CreatedAt
 	}
 
-	stream := cipher.NewCFBEncrypter(block, iv)
-	stream.XORKeyStream(ciphertext[aes.BlockSize:], plaintext)
+	encoded, err := env.Encode()
+	if err != nil {
+		return err
+	}
 
-	e.encrypted = hex.EncodeToString(ciphertext)
+	e.envelope = env
+	e.encrypted = encoded
+	return nil
 }
 
-func (e *EnvFile) decrypt(key string) {
-	ciphertext, err := hex.DecodeString(e.encrypted)
-	if err != nil {
-		panic(err)
+func (e *EnvFile) decrypt(secret string) error {
+	if e.envelope == nil {
+		env, err := DecodeEnvelope(e.encrypted)
+		if err != nil {
+			return err
+		}
+		e.envelope = env
 	}
 
-	block, err := aes.NewCipher([]byte(key))
+	plaintext, err := e.envelope.open(secret)
 	if err != nil {
-		panic(err)
-	}
-
-	if len(ciphertext) < aes.BlockSize {
-		panic("ciphertext too short")
+		return err
 	}
 
-	iv := ciphertext[:aes.BlockSize]
-	ciphertext = ciphertext[aes.BlockSize:]
-
-	stream := cipher.NewCFBDecrypter(block, iv)
-	stream.XORKeyStream(ciphertext, ciphertext)
-
-	e.fileContent = string(ciphertext)
+	e.fileContent = string(plaintext)
+	return nil
 }
 
 /// Functions
 
-func GetEnvFile(identifier string, folder *string) (*EnvFile, error) {
-	f, err := GetOrCreateFolder(folder)
-
-	if err != nil {
-		return nil, err
+// GetEnvFile reads the encrypted file of a configuration listed in the
+// manifest. Unknown identifiers wrap ErrNotFound
+func (f *Folder) GetEnvFile(identifier string) (*EnvFile, error) {
+	if !f.hasIdentifier(identifier) {
+		return nil, fmt.Errorf("%w: invalid identifier - %s", ErrNotFound, identifier)
 	}
 
-	allIdentifiers := f.GetIdentifiers()
+	name := storedName(identifier)
+	logf("Reading file: %s\n", name)
 
-	for _, id := range allIdentifiers {
-		if string(id) == identifier {
-			return ReadEnvFile(fmt.Sprintf("%s/%s%s", f.FolderPath, SAVED_PREFIX, identifier)), nil
-		}
+	content, err := f.store.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
 	}
-
-	return nil, errors.New("invalid identifier - " + identifier)
-}
-
-func GetEnvFiles(folder *string) ([]*EnvFile, error) {
-	f, err := GetOrCreateFolder(folder)
 	if err != nil {
 		return nil, err
 	}
 
-	allIdentifiers := f.GetIdentifiers()
+	return newStoredEnvFile(f, identifier, string(content)), nil
+}
 
+func (f *Folder) GetEnvFiles() ([]*EnvFile, error) {
 	var envFiles []*EnvFile
 
-	for _, id := range allIdentifiers {
-		filePath := fmt.Sprintf("%s/%s%s", *folder, SAVED_PREFIX, id)
-		e := ReadEnvFile(filePath)
+	for _, id := range f.Identifiers() {
+		e, err := f.GetEnvFile(id)
+		if err != nil {
+			return nil, err
+		}
 		envFiles = append(envFiles, e)
 	}
 
 	return envFiles, nil
 }
 
-func RestoreEnvFile(e *EnvFile, decryptSecret string) {
-	e.decrypt(decryptSecret)
+// SaveEnvFile encrypts the environment file for the recipients of the
+// folder, or with the secret if there are none, and writes it to the store
+// with a new revision in its history.
+// Configurations that do not match the schema are refused
+func (f *Folder) SaveEnvFile(e *EnvFile, encryptSecret string) error {
+	e.folder = f
+	name := storedName(e.header.Identifier)
 
-	// Re-parse header from decrypted content to get correct restoreAs
-	h, err := InitHeader(e.fileContent)
-	if err == nil {
-		e.header = h
+	if err := f.validate(e); err != nil {
+		return err
 	}
 
-	e.readRestoreAs()
-
-	fmt.Printf("Restoring file %s as %s\n", e.folderPath, e.header.RestoreAs)
-
-	f, err := os.Create(e.header.RestoreAs)
+	// Overwriting an existing configuration keeps its creation time
+	previous, err := f.store.ReadFile(name)
+	if err == nil && e.envelope == nil {
+		e.envelope, _ = DecodeEnvelope(string(previous))
+	}
 
+	recipients, err := f.LoadRecipients()
 	if err != nil {
-		fmt.Println("Error creating file")
-		fmt.Println(err)
-		os.Exit(1)
+		return fmt.Errorf("reading recipients: %w", err)
 	}
 
-	defer f.Close()
+	if err := e.encrypt(encryptSecret, recipients); err != nil {
+		return fmt.Errorf("encrypting %s: %w", e.header.Identifier, err)
+	}
+	logf("Saving file: %s\n", name)
 
-	// Write file
+	if err := f.store.WriteFile(name, []byte(e.encrypted)); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
 
-	_, err = f.WriteString(e.fileContent)
+	if err := f.recordSaved(e); err != nil {
+		return err
+	}
 
-	if err != nil {
-		fmt.Println("Error writing file")
-		fmt.Println(err)
-		os.Exit(1)
+	if err := f.addRevision(e.header.Identifier, string(previous), e.encrypted, e.envelope.UpdatedAt); err != nil {
+		return fmt.Errorf("writing history of %s: %w", e.header.Identifier, err)
 	}
+	return nil
 }
 
-// SaveEnvFile saves the environment file to the env-manager folder
-// in the encrypted format
-func SaveEnvFile(e *EnvFile, encryptSecret string, folderPath *string) {
-	e.encrypt(encryptSecret)
-
-	if e.folderPath == "" {
-		e.folderPath = *folderPath
+func GetEnvFile(identifier string, folder *string) (*EnvFile, error) {
+	f, err := GetOrCreateFolder(folder)
+	if err != nil {
+		return nil, err
 	}
+	return f.GetEnvFile(identifier)
+}
 
-	filePath := fmt.Sprintf("%s/%s%s", e.folderPath, SAVED_PREFIX, e.header.Identifier)
-	fmt.Printf("Saving file: %s\n", filePath)
-
-	f, err := os.Create(filePath)
-
+func GetEnvFiles(folder *string) ([]*EnvFile, error) {
+	f, err := GetOrCreateFolder(folder)
 	if err != nil {
-		fmt.Println("Error creating file")
-		fmt.Println(err)
-		os.Exit(1)
+		return nil, err
 	}
+	return f.GetEnvFiles()
+}
 
-	defer f.Close()
+// newStoredEnvFile wraps the encrypted content of a configuration. The
+// header is only known once it is decrypted
+func newStoredEnvFile(f *Folder, identifier string, content string) *EnvFile {
+	e := &EnvFile{
+		encrypted: content,
+		folder:    f,
+		header: &Header{
+			Identifier: identifier,
+			RestoreAs:  DEFAULT_RESTORE_AS,
+		},
+	}
+	// Detect the format version. Undecodable files fail on decrypt
+	e.envelope, _ = DecodeEnvelope(content)
+	return e
+}
 
-	// Write file
+// DecryptEnvFile decrypts the environment file in memory and reads
+// the headers from the decrypted content
+func DecryptEnvFile(e *EnvFile, decryptSecret string) error {
+	if err := e.decrypt(decryptSecret); err != nil {
+		return err
+	}
+
+	// Re-parse header from decrypted content to get correct restoreAs
+	h, err := InitHeader(e.fileContent)
+	if err == nil {
+		e.header = h
+	}
 
-	_, err = f.WriteString(e.encrypted)
+	e.readRestoreAs()
+	return nil
+}
 
-	if err != nil {
-		fmt.Println("Error writing file")
-		fmt.Println(err)
-		os.Exit(1)
+// SaveEnvFile saves the environment file to the env-manager folder
+// in the encrypted format. Files read from a folder are saved back to it
+func SaveEnvFile(e *EnvFile, encryptSecret string, folderPath *string) error {
+	f := e.folder
+	if f == nil {
+		var err error
+		f, err = GetOrCreateFolder(folderPath)
+		if err != nil {
+			return err
+		}
 	}
+	return f.SaveEnvFile(e, encryptSecret)
 }
 
 func InitEnvFile(identifier string, restoreAs string) *EnvFile {
@@ -218,54 +254,39 @@ func (e *EnvFile) SetContent(content string) {
 	e.fileContent = headerContent + content
 }
 
-func ReadEnvFile(filePath string) *EnvFile {
-	fmt.Printf("Reading file: %s\n", filePath)
-
-	f, err := os.Open(filePath)
+// ReadEnvFile reads a plain file with headers, or a saved file when the
+// path is inside the env-manager folder. Missing files wrap ErrNotFound
+func ReadEnvFile(filePath string) (*EnvFile, error) {
+	logf("Reading file: %s\n", filePath)
 
-	if err != nil {
-		fmt.Println("Error opening file")
-		fmt.Println(err)
-		os.Exit(1)
+	fileBytes, err := os.ReadFile(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, filePath)
 	}
-
-	defer f.Close()
-
-	// Read file
-
-	fileBytes, err := io.ReadAll(f)
-
 	if err != nil {
-		fmt.Println("Error reading file")
-		fmt.Println(err)
-		os.Exit(1)
+		return nil, err
 	}
 
 	c := string(fileBytes)
 
-	e := EnvFile{}
 	// If filepath starts with the .env-manager folder
 	// then the content is encrypted
 	if strings.Contains(filePath, DEFAULT_ENV_FOLDER) || strings.Contains(filePath, SAVED_PREFIX) {
-		e.encrypted = c
-		e.folderPath = filePath
 		// For encrypted files, extract identifier from filename
-		parts := strings.Split(filePath, "/")
-		filename := parts[len(parts)-1]
+		dir, filename := filepath.Split(filePath)
 		identifier := strings.TrimPrefix(filename, SAVED_PREFIX)
-		e.header = &Header{
-			Identifier: identifier,
-			RestoreAs:  DEFAULT_RESTORE_AS,
-		}
-	} else {
-		e.fileContent = c
-		h, err := InitHeader(c)
+		f, err := OpenFolder(NewDirStore(filepath.Clean(dir)))
 		if err != nil {
-			fmt.Println("Error initializing header")
-			fmt.Println(err)
-			os.Exit(1)
+			return nil, err
 		}
-		e.header = h
+		return newStoredEnvFile(f, identifier, c), nil
 	}
-	return &e
+
+	e := EnvFile{fileContent: c}
+	h, err := InitHeader(c)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+	e.header = h
+	return &e, nil
 }
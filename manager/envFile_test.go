@@ -1,13 +1,21 @@
 package manager
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"testing"
 )
 
-func destroyTestFolder(folderPath *string) {
-	os.RemoveAll(*folderPath)
+// newTestFolder returns an empty folder kept in memory
+func newTestFolder(t *testing.T) *Folder {
+	t.Helper()
+	f, err := OpenFolder(NewMemoryStore())
+	if err != nil {
+		t.Fatalf("OpenFolder() = %v, want %v", err, nil)
+	}
+	return f
 }
 
 func createEnvFile(path string, content string) {
@@ -27,10 +35,6 @@ func createEnvFile(path string, content string) {
 
 }
 
-func deleteEnvFile(path string) {
-	os.Remove(path)
-}
-
 func getEnvFileContent(identifier string, keyValuePairs ...string) string {
 	content := fmt.Sprintf("#- identifier: %s\n#- restore-as: %s\n", identifier, DEFAULT_RESTORE_AS)
 
@@ -45,17 +49,17 @@ func TestReadEnvFile(t *testing.T) {
 	const ENV_FILE_PATH = ".env-test"
 	const ENV_FILE_CONTENT = "HELLO=WORLD\n"
 	const ENV_FILE_IDENTIFIER = "test"
-
-	defer func() {
-		deleteEnvFile(ENV_FILE_PATH)
-	}()
+	t.Chdir(t.TempDir())
 
 	content := getEnvFileContent(ENV_FILE_IDENTIFIER, ENV_FILE_CONTENT)
 	createEnvFile(ENV_FILE_PATH, content)
 
 	// folderPath := createTestFolder()
 
-	e := ReadEnvFile(ENV_FILE_PATH)
+	e, err := ReadEnvFile(ENV_FILE_PATH)
+	if err != nil {
+		t.Fatalf("ReadEnvFile() = %v, want %v", err, nil)
+	}
 
 	wantIdentifier := ENV_FILE_IDENTIFIER == e.Identifier()
 	wantContent := content == e.fileContent
@@ -80,34 +84,32 @@ func TestSaveAndReadEnvFile(t *testing.T) {
 	const ENV_FILE_IDENTIFIER = "test"
 	const ENCRYPT_SECRET = "488c447d4919b142c80c82832cef7f18"
 	var FOLDER_PATH = ".env-manager-test"
-
-	defer func() {
-		fmt.Println("Destroying test folder")
-		destroyTestFolder(&FOLDER_PATH)
-		deleteEnvFile(ENV_FILE_PATH)
-		deleteEnvFile(".env")
-	}()
+	t.Chdir(t.TempDir())
 
 	content := getEnvFileContent(ENV_FILE_IDENTIFIER, ENV_FILE_CONTENT)
 	createEnvFile(ENV_FILE_PATH, content)
 
 	// Simulate an init operation
 	// Read the file given by the user (created as a fixture)
-	e := ReadEnvFile(ENV_FILE_PATH)
+	e, err := ReadEnvFile(ENV_FILE_PATH)
+	if err != nil {
+		t.Fatalf("ReadEnvFile() = %v, want %v", err, nil)
+	}
 	f, err := GetOrCreateFolder(&FOLDER_PATH)
 	if err != nil {
 		t.Errorf("GetOrCreateFolder() = %v, want %v", err, nil)
 	}
 	f.AddFileIdentifier(EnvFilePath(ENV_FILE_PATH), EnvFileIdentifier(ENV_FILE_IDENTIFIER))
 	// Inject custom folder path
-	SaveEnvFile(e, ENCRYPT_SECRET, &f.FolderPath)
+	if err := SaveEnvFile(e, ENCRYPT_SECRET, &f.FolderPath); err != nil {
+		t.Fatalf("SaveEnvFile() = %v, want %v", err, nil)
+	}
 
 	// Read env file in the folder
 	e, err = GetEnvFile(ENV_FILE_IDENTIFIER, &f.FolderPath)
 	if err != nil {
 		t.Errorf("GetEnvFile() = %v, want %v", err, nil)
 	}
-	println(e.encrypted)
 	// File is read and encrypted, the identifier is unknown
 	wantIdentifier := e.Identifier() == ENV_FILE_IDENTIFIER
 	wantEncrypted := e.encrypted != ""
@@ -145,7 +147,9 @@ func TestSaveAndReadEnvFile(t *testing.T) {
 	}
 
 	// Restore env file
-	RestoreEnvFile(toRestore, ENCRYPT_SECRET)
+	if err := RestoreEnvFile(toRestore, ENCRYPT_SECRET); err != nil {
+		t.Fatalf("RestoreEnvFile() = %v, want %v", err, nil)
+	}
 
 	RESTORED := ".env"
 
@@ -168,13 +172,7 @@ func TestInitEnvFile(t *testing.T) {
 	const ENV_FILE_IDENTIFIER = "production"
 	const ENV_FILE_RESTORE_AS = ".env.production"
 	const ENCRYPT_SECRET = "488c447d4919b142c80c82832cef7f18"
-	var FOLDER_PATH = ".env-manager-test-init"
-
-	defer func() {
-		fmt.Println("Destroying test folder")
-		destroyTestFolder(&FOLDER_PATH)
-		deleteEnvFile(ENV_FILE_RESTORE_AS)
-	}()
+	t.Chdir(t.TempDir())
 
 	// Create env file using InitEnvFile
 	e := InitEnvFile(ENV_FILE_IDENTIFIER, ENV_FILE_RESTORE_AS)
@@ -193,18 +191,16 @@ func TestInitEnvFile(t *testing.T) {
 	e.SetContent(rawContent)
 
 	// Create folder and save
-	f, err := GetOrCreateFolder(&FOLDER_PATH)
-	if err != nil {
-		t.Errorf("GetOrCreateFolder() = %v, want %v", err, nil)
-	}
-
+	f := newTestFolder(t)
 	f.AddFileIdentifier(EnvFilePath("manual"), EnvFileIdentifier(ENV_FILE_IDENTIFIER))
-	SaveEnvFile(e, ENCRYPT_SECRET, &f.FolderPath)
+	if err := f.SaveEnvFile(e, ENCRYPT_SECRET); err != nil {
+		t.Fatalf("SaveEnvFile() = %v, want %v", err, nil)
+	}
 
 	// Read it back
-	e2, err := GetEnvFile(ENV_FILE_IDENTIFIER, &f.FolderPath)
+	e2, err := f.GetEnvFile(ENV_FILE_IDENTIFIER)
 	if err != nil {
-		t.Errorf("GetEnvFile() = %v, want %v", err, nil)
+		t.Fatalf("GetEnvFile() = %v, want %v", err, nil)
 	}
 
 	if e2.Identifier() != ENV_FILE_IDENTIFIER {
@@ -212,7 +208,9 @@ func TestInitEnvFile(t *testing.T) {
 	}
 
 	// Restore and verify content
-	RestoreEnvFile(e2, ENCRYPT_SECRET)
+	if err := RestoreEnvFile(e2, ENCRYPT_SECRET); err != nil {
+		t.Fatalf("RestoreEnvFile() = %v, want %v", err, nil)
+	}
 
 	restoredContent, err := os.ReadFile(ENV_FILE_RESTORE_AS)
 	if err != nil {
@@ -225,3 +223,65 @@ func TestInitEnvFile(t *testing.T) {
 		t.Errorf("Restored content = %v, want %v", string(restoredContent), expectedContent)
 	}
 }
+
+func TestReadEnvFileErrors(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	if _, err := ReadEnvFile("does-not-exist.env"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ReadEnvFile() = %v, want %v", err, ErrNotFound)
+	}
+
+	path := ".env.no-header"
+	createEnvFile(path, "HELLO=WORLD\n")
+
+	// Paths with the saved prefix are read as encrypted files
+	e, err := ReadEnvFile(path)
+	if err != nil {
+		t.Fatalf("ReadEnvFile() = %v, want %v", err, nil)
+	}
+	if !e.IsEncrypted() {
+		t.Errorf("ReadEnvFile() encrypted = %v, want %v", e.IsEncrypted(), true)
+	}
+
+	plain := "no-header.env"
+	createEnvFile(plain, "HELLO=WORLD\n")
+
+	if _, err := ReadEnvFile(plain); !errors.Is(err, ErrHeaderMissing) {
+		t.Errorf("ReadEnvFile() = %v, want %v", err, ErrHeaderMissing)
+	}
+}
+
+func TestGetEnvFileNotFound(t *testing.T) {
+	f := newTestFolder(t)
+
+	if _, err := f.GetEnvFile("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetEnvFile() = %v, want %v", err, ErrNotFound)
+	}
+
+	// Listed in the manifest but missing from the store
+	f.AddFileIdentifier(EnvFilePath("lost"), EnvFileIdentifier("lost"))
+	if _, err := f.GetEnvFile("lost"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetEnvFile() = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestRemoveEnvFile(t *testing.T) {
+	f := newTestFolder(t)
+	saveTestEnvFile(t, f, "production", TEST_SECRET, "HELLO=WORLD\n")
+	f.AddFileIdentifier(EnvFilePath("other/.env"), EnvFileIdentifier("production"))
+
+	if err := f.RemoveEnvFile("production"); err != nil {
+		t.Fatalf("RemoveEnvFile() = %v, want %v", err, nil)
+	}
+
+	if len(f.Identifiers()) != 0 {
+		t.Errorf("RemoveEnvFile() left %v in the manifest", f.Identifiers())
+	}
+	if _, err := f.Store().ReadFile(storedName("production")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("RemoveEnvFile() left the encrypted file: %v", err)
+	}
+
+	if err := f.RemoveEnvFile("production"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("RemoveEnvFile() = %v, want %v", err, ErrNotFound)
+	}
+}
@@ -0,0 +1,266 @@
+package manager
+
+import (
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Cipher identifiers stored in the envelope
+const CIPHER_AES_GCM = "aes-gcm"
+const CIPHER_AES_CFB = "aes-cfb"
+
+// KDF identifiers stored in the envelope
+const KDF_SCRYPT = "scrypt"
+
+// Upper bounds for the KDF parameters accepted from a file, so a crafted
+// envelope cannot make decryption allocate unbounded memory
+const MAX_SCRYPT_N = 1 << 20
+const MAX_SCRYPT_R = 32
+const MAX_SCRYPT_P = 16
+
+// scrypt allocates 128*N*r bytes and its time grows with N*r*p
+const MAX_SCRYPT_MEMORY = 256 << 20
+const MAX_SCRYPT_WORK = 1 << 22
+
+// HKDF info of the key check, derived from the key of each file so a
+// wrong secret is told apart from a modified file
+const KEY_CHECK_INFO = "env-manager key check"
+const KEY_CHECK_SIZE = 8
+
+// KDFParams describes how the encryption key is derived from the secret
+type KDFParams struct {
+	Name string `json:"name"`
+	Salt []byte `json:"salt"`
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+}
+
+// Envelope is the self-describing format of an encrypted env file.
+// Legacy files are decoded into an Envelope with version 0 so every
+// file goes through the same decryption path
+type Envelope struct {
+	Format     string     `json:"format"`
+	Version    int        `json:"version"`
+	Cipher     string     `json:"cipher"`
+	KDF        *KDFParams `json:"kdf,omitempty"`
+	KeyCheck   string     `json:"key_check,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Ciphertext []byte     `json:"ciphertext"`
+
+	// Set when the file is encrypted with a random data key wrapped
+	// for each recipient instead of a key derived from the secret
+	Recipients []*RecipientStanza `json:"recipients,omitempty"`
+}
+
+// keyCheck returns a short value derived from the key of a file. The key
+// comes from the salt of the file, so the check cannot be precomputed
+func keyCheck(key []byte) (string, error) {
+	check, err := hkdf.Expand(sha256.New, key, KEY_CHECK_INFO, KEY_CHECK_SIZE)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(check), nil
+}
+
+// sealEnvelope encrypts the plaintext into a new envelope in the current format.
+// Without recipients the key is derived from the secret, otherwise a random
+// data key is wrapped for each recipient and the secret is not used
+func sealEnvelope(secret string, recipients []*Recipient, plaintext []byte) (*Envelope, error) {
+	if len(recipients) > 0 {
+		return sealEnvelopeForRecipients(recipients, plaintext)
+	}
+
+	salt, err := newSalt()
+	if err != nil {
+		return nil, err
+	}
+
+	kdf := &KDFParams{Name: KDF_SCRYPT, Salt: salt, N: SCRYPT_N, R: SCRYPT_R, P: SCRYPT_P}
+	key, err := kdf.deriveKey(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := sealGCM(key, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	check, err := keyCheck(key)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	return &Envelope{
+		Format:     FORMAT_NAME,
+		Version:    FORMAT_VERSION,
+		Cipher:     CIPHER_AES_GCM,
+		KDF:        kdf,
+		KeyCheck:   check,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		Ciphertext: ciphertext,
+	}, nil
+}
+
+func sealEnvelopeForRecipients(recipients []*Recipient, plaintext []byte) (*Envelope, error) {
+	dataKey := make([]byte, KEY_SIZE)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := sealGCM(dataKey, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	stanzas, err := wrapForRecipients(dataKey, recipients)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	return &Envelope{
+		Format:     FORMAT_NAME,
+		Version:    FORMAT_VERSION,
+		Cipher:     CIPHER_AES_GCM,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		Ciphertext: ciphertext,
+		Recipients: stanzas,
+	}, nil
+}
+
+func (k *KDFParams) deriveKey(secret string) ([]byte, error) {
+	switch k.Name {
+	case KDF_SCRYPT:
+		if k.N > MAX_SCRYPT_N || k.R > MAX_SCRYPT_R || k.P > MAX_SCRYPT_P ||
+			128*k.N*k.R > MAX_SCRYPT_MEMORY || k.N*k.R*k.P > MAX_SCRYPT_WORK {
+			return nil, fmt.Errorf("%w: scrypt parameters out of range", ErrUnsupportedFormat)
+		}
+		return scrypt.Key([]byte(secret), k.Salt, k.N, k.R, k.P, KEY_SIZE)
+	default:
+		return nil, fmt.Errorf("%w: kdf %q", ErrUnsupportedFormat, k.Name)
+	}
+}
+
+// open decrypts the ciphertext with a key derived from the secret.
+// Legacy files use the raw secret as key, envelopes with recipients
+// expect the secret to be the identity of a recipient
+func (env *Envelope) open(secret string) ([]byte, error) {
+	key, err := env.contentKey(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	var plaintext []byte
+	switch env.Cipher {
+	case CIPHER_AES_GCM:
+		plaintext, err = openGCM(key, env.Ciphertext)
+	case CIPHER_AES_CFB:
+		plaintext, err = openLegacyCFB(key, env.Ciphertext)
+	default:
+		return nil, fmt.Errorf("%w: cipher %q", ErrUnsupportedFormat, env.Cipher)
+	}
+
+	// The key is known to be right, so a failure means the file changed
+	if errors.Is(err, errWrongKeyOrCorrupt) && env.Cipher == CIPHER_AES_GCM {
+		return nil, corruptFileError("")
+	}
+	return plaintext, err
+}
+
+// contentKey returns the key the payload is encrypted with. Envelopes with
+// a key check report a wrong secret before anything is decrypted
+func (env *Envelope) contentKey(secret string) ([]byte, error) {
+	if len(env.Recipients) > 0 {
+		identity, err := ParseIdentity(secret)
+		if err != nil {
+			return nil, badKeyError("file is encrypted for recipients, the secret must be an identity")
+		}
+		return identity.unwrapKey(env.Recipients)
+	}
+
+	if env.Cipher == CIPHER_AES_CFB {
+		return []byte(secret), nil
+	}
+
+	if env.KDF == nil {
+		return nil, fmt.Errorf("%w: missing kdf", ErrUnsupportedFormat)
+	}
+
+	key, err := env.KDF.deriveKey(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	check, err := keyCheck(key)
+	if err != nil {
+		return nil, err
+	}
+	if check != env.KeyCheck {
+		return nil, badKeyError("")
+	}
+
+	return key, nil
+}
+
+// Encode serializes the envelope as it is written to disk
+func (env *Envelope) Encode() (string, error) {
+	b, err := json.MarshalIndent(env, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b) + "\n", nil
+}
+
+// DecodeEnvelope detects the format of a saved file and decodes it:
+//   - JSON envelope, encrypted with a scrypt derived key or for recipients
+//   - legacy bare hex, AES-CFB with the raw secret
+func DecodeEnvelope(content string) (*Envelope, error) {
+	content = strings.TrimSpace(content)
+
+	if strings.HasPrefix(content, "{") {
+		return decodeJSONEnvelope(content)
+	}
+
+	ciphertext, err := hex.DecodeString(content)
+	if err != nil {
+		return nil, corruptFileError(err.Error())
+	}
+	return &Envelope{Version: 0, Cipher: CIPHER_AES_CFB, Ciphertext: ciphertext}, nil
+}
+
+func decodeJSONEnvelope(content string) (*Envelope, error) {
+	env := &Envelope{}
+	if err := json.Unmarshal([]byte(content), env); err != nil {
+		return nil, corruptFileError(err.Error())
+	}
+
+	if env.Format != FORMAT_NAME {
+		return nil, fmt.Errorf("%w: format %q", ErrUnsupportedFormat, env.Format)
+	}
+
+	if env.Version < 1 || env.Version > FORMAT_VERSION {
+		return nil, fmt.Errorf("%w: version %d", ErrUnsupportedFormat, env.Version)
+	}
+
+	// Only legacy files are encrypted with CFB
+	if env.Cipher == CIPHER_AES_CFB {
+		return nil, fmt.Errorf("%w: cipher %q", ErrUnsupportedFormat, env.Cipher)
+	}
+
+	return env, nil
+}
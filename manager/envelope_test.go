@@ -0,0 +1,123 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnvelopeMetadata(t *testing.T) {
+	e := &EnvFile{fileContent: getEnvFileContent("test", "HELLO=WORLD")}
+	e.encrypt(TEST_SECRET, nil)
+
+	env, err := DecodeEnvelope(e.encrypted)
+	if err != nil {
+		t.Fatalf("DecodeEnvelope() = %v, want %v", err, nil)
+	}
+
+	if env.Format != FORMAT_NAME || env.Version != FORMAT_VERSION {
+		t.Errorf("DecodeEnvelope() format = %v v%v, want %v v%v", env.Format, env.Version, FORMAT_NAME, FORMAT_VERSION)
+	}
+
+	if env.Cipher != CIPHER_AES_GCM {
+		t.Errorf("DecodeEnvelope() cipher = %v, want %v", env.Cipher, CIPHER_AES_GCM)
+	}
+
+	if env.KDF == nil || env.KDF.Name != KDF_SCRYPT || len(env.KDF.Salt) != SALT_SIZE {
+		t.Errorf("DecodeEnvelope() kdf = %+v, want scrypt with %d byte salt", env.KDF, SALT_SIZE)
+	}
+
+	if env.CreatedAt.IsZero() || env.UpdatedAt.IsZero() {
+		t.Errorf("DecodeEnvelope() timestamps = %v, %v, want non zero", env.CreatedAt, env.UpdatedAt)
+	}
+
+	key, _ := env.KDF.deriveKey(TEST_SECRET)
+	wantCheck, _ := keyCheck(key)
+	if env.KeyCheck == "" || env.KeyCheck != wantCheck {
+		t.Errorf("DecodeEnvelope() key_check = %v, want %v", env.KeyCheck, wantCheck)
+	}
+
+	// The check depends on the salt of the file, not only on the secret
+	other := &EnvFile{fileContent: e.fileContent}
+	other.encrypt(TEST_SECRET, nil)
+	if other.envelope.KeyCheck == env.KeyCheck {
+		t.Errorf("key_check is the same for two files: %v", env.KeyCheck)
+	}
+}
+
+func TestDecodeEnvelopeFutureVersion(t *testing.T) {
+	encoded := fmt.Sprintf(`{"format": %q, "version": %d, "cipher": %q}`, FORMAT_NAME, FORMAT_VERSION+1, CIPHER_AES_GCM)
+	_, err := DecodeEnvelope(encoded)
+	if !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("DecodeEnvelope() = %v, want %v", err, ErrUnsupportedFormat)
+	}
+}
+
+func TestEnvelopeOversizedKDF(t *testing.T) {
+	tests := []struct {
+		name    string
+		n, r, p int
+	}{
+		{"memory", MAX_SCRYPT_N, MAX_SCRYPT_R, 1},
+		{"work", 1 << 18, SCRYPT_R, MAX_SCRYPT_P},
+	}
+
+	for _, tt := range tests {
+		encoded := fmt.Sprintf(`{"format": %q, "version": %d, "cipher": %q, "kdf": {"name": %q, "salt": "AAAA", "n": %d, "r": %d, "p": %d}}`,
+			FORMAT_NAME, FORMAT_VERSION, CIPHER_AES_GCM, KDF_SCRYPT, tt.n, tt.r, tt.p)
+		env, err := DecodeEnvelope(encoded)
+		if err != nil {
+			t.Fatalf("%s: DecodeEnvelope() = %v, want %v", tt.name, err, nil)
+		}
+
+		if _, err := env.open(TEST_SECRET); !errors.Is(err, ErrUnsupportedFormat) {
+			t.Errorf("%s: open() = %v, want %v", tt.name, err, ErrUnsupportedFormat)
+		}
+	}
+}
+
+func TestSaveEnvFileKeepsCreatedAt(t *testing.T) {
+	const ENV_FILE_IDENTIFIER = "created"
+
+	f := newTestFolder(t)
+	f.AddFileIdentifier(EnvFilePath("manual"), EnvFileIdentifier(ENV_FILE_IDENTIFIER))
+
+	first := InitEnvFile(ENV_FILE_IDENTIFIER, DEFAULT_RESTORE_AS)
+	first.SetContent("HELLO=WORLD\n")
+	if err := f.SaveEnvFile(first, TEST_SECRET); err != nil {
+		t.Fatalf("SaveEnvFile() = %v, want %v", err, nil)
+	}
+	createdAt := first.Envelope().CreatedAt
+
+	time.Sleep(10 * time.Millisecond)
+
+	second := InitEnvFile(ENV_FILE_IDENTIFIER, DEFAULT_RESTORE_AS)
+	second.SetContent("HELLO=AGAIN\n")
+	if err := f.SaveEnvFile(second, TEST_SECRET); err != nil {
+		t.Fatalf("SaveEnvFile() = %v, want %v", err, nil)
+	}
+
+	saved, err := f.Store().ReadFile(storedName(ENV_FILE_IDENTIFIER))
+	if err != nil {
+		t.Fatalf("ReadFile() = %v, want %v", err, nil)
+	}
+
+	if !strings.HasPrefix(string(saved), "{") {
+		t.Errorf("SaveEnvFile() = %v, want a JSON envelope", string(saved))
+	}
+
+	env, err := DecodeEnvelope(string(saved))
+	if err != nil {
+		t.Fatalf("DecodeEnvelope() = %v, want %v", err, nil)
+	}
+
+	if !env.CreatedAt.Equal(createdAt) {
+		t.Errorf("SaveEnvFile() created_at = %v, want %v", env.CreatedAt, createdAt)
+	}
+
+	if !env.UpdatedAt.After(createdAt) {
+		t.Errorf("SaveEnvFile() updated_at = %v, want after %v", env.UpdatedAt, createdAt)
+	}
+}
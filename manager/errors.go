@@ -0,0 +1,50 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by the package, to be checked with errors.Is.
+
+// An identifier, a stored file or a source file does not exist
+var ErrNotFound = errors.New("not found")
+
+// The identifier or restore-as header is missing from the content
+var ErrHeaderMissing = errors.New("header missing")
+
+// Neither ENV_MANAGER_SECRET nor the .secret file holds a secret
+var ErrNoSecret = errors.New("no secret found")
+
+// Returned for every file that cannot be decrypted. It wraps ErrBadKey or
+// ErrCorruptFile when the format can tell them apart
+var ErrDecryptionFailed = errors.New("decryption failed")
+
+// The secret is not the one the file was encrypted with
+var ErrBadKey = errors.New("wrong secret")
+
+// The encrypted file is damaged or has been modified
+var ErrCorruptFile = errors.New("corrupt or tampered file")
+
+// Returned when a saved file uses a format this version cannot read
+var ErrUnsupportedFormat = errors.New("unsupported file format")
+
+func badKeyError(detail string) error {
+	if detail == "" {
+		return fmt.Errorf("%w: %w", ErrDecryptionFailed, ErrBadKey)
+	}
+	return fmt.Errorf("%w: %w: %s", ErrDecryptionFailed, ErrBadKey, detail)
+}
+
+func corruptFileError(detail string) error {
+	if detail == "" {
+		return fmt.Errorf("%w: %w", ErrDecryptionFailed, ErrCorruptFile)
+	}
+	return fmt.Errorf("%w: %w: %s", ErrDecryptionFailed, ErrCorruptFile, detail)
+}
+
+// Formats without a key check cannot tell a wrong secret from a modified file
+var errWrongKeyOrCorrupt = fmt.Errorf("%w: wrong secret or tampered file", ErrDecryptionFailed)
+
+// A file in the store was changed by someone else since it was read
+var ErrConflict = errors.New("store changed concurrently")
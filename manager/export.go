@@ -0,0 +1,214 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Formats a configuration can be exported to
+const EXPORT_DOTENV = "dotenv"
+const EXPORT_JSON = "json"
+const EXPORT_YAML = "yaml"
+const EXPORT_SHELL = "shell"
+const EXPORT_SYSTEMD = "systemd"
+const EXPORT_DOCKER = "docker"
+const EXPORT_KUBERNETES = "kubernetes"
+
+var ExportFormats = []string{EXPORT_DOTENV, EXPORT_JSON, EXPORT_YAML, EXPORT_SHELL, EXPORT_SYSTEMD, EXPORT_DOCKER, EXPORT_KUBERNETES}
+
+// RenderVariables renders the variables in the given format. name is used
+// where the format needs one, like the metadata of a Kubernetes Secret.
+func RenderVariables(d *Dotenv, format string, name string) (string, error) {
+	switch format {
+	case EXPORT_DOTENV:
+		return renderDotenv(d), nil
+	case EXPORT_JSON:
+		return renderJSON(d), nil
+	case EXPORT_YAML:
+		return renderYAML(d), nil
+	case EXPORT_SHELL:
+		return renderShell(d)
+	case EXPORT_SYSTEMD:
+		return renderSystemd(d), nil
+	case EXPORT_DOCKER:
+		return renderDocker(d)
+	case EXPORT_KUBERNETES, "k8s":
+		return renderKubernetes(d, name), nil
+	default:
+		return "", fmt.Errorf("unknown format %q, valid formats are %s", format, strings.Join(ExportFormats, ", "))
+	}
+}
+
+// jsonString encodes s as a JSON string, which is also a valid
+// YAML double quoted scalar
+func jsonString(s string) string {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// Plain YAML scalars that would not be read back as strings
+var yamlReserved = map[string]bool{
+	"y": true, "yes": true, "n": true, "no": true, "true": true, "false": true,
+	"on": true, "off": true, "null": true, "~": true,
+}
+
+// yamlKey quotes keys that are not plain names, like -A or .inf, and
+// reserved words, so they are read back as the same string
+func yamlKey(key string) string {
+	if !isShellName(key) || yamlReserved[strings.ToLower(key)] {
+		return jsonString(key)
+	}
+	return key
+}
+
+// renderDotenv renders the variables only, without comments and headers
+func renderDotenv(d *Dotenv) string {
+	var b strings.Builder
+	vars := d.Map()
+	for _, key := range d.Keys() {
+		fmt.Fprintf(&b, "%s=%s\n", key, quoteDotenvValue(vars[key], 0))
+	}
+	return b.String()
+}
+
+func renderJSON(d *Dotenv) string {
+	keys := d.Keys()
+	if len(keys) == 0 {
+		return "{}\n"
+	}
+
+	var b strings.Builder
+	vars := d.Map()
+	b.WriteString("{\n")
+	for i, key := range keys {
+		fmt.Fprintf(&b, "  %s: %s", jsonString(key), jsonString(vars[key]))
+		if i < len(keys)-1 {
+			b.WriteByte(',')
+		}
+		b.WriteByte('\n')
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func renderYAML(d *Dotenv) string {
+	keys := d.Keys()
+	if len(keys) == 0 {
+		return "{}\n"
+	}
+
+	var b strings.Builder
+	vars := d.Map()
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s: %s\n", yamlKey(key), jsonString(vars[key]))
+	}
+	return b.String()
+}
+
+// renderShell renders export statements. Values are single quoted, so
+// nothing in them is expanded when the file is sourced. Keys a shell
+// cannot name, like A.B, cannot be exported
+func renderShell(d *Dotenv) (string, error) {
+	var b strings.Builder
+	vars := d.Map()
+	for _, key := range d.Keys() {
+		if !isShellName(key) {
+			return "", fmt.Errorf("%s is not a valid shell variable name", key)
+		}
+		value := strings.ReplaceAll(vars[key], "'", `'\''`)
+		fmt.Fprintf(&b, "export %s='%s'\n", key, value)
+	}
+	return b.String(), nil
+}
+
+// isShellName reports whether key matches [A-Za-z_][A-Za-z0-9_]*
+func isShellName(key string) bool {
+	for i, c := range key {
+		letter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+		if !letter && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return key != ""
+}
+
+// renderSystemd renders an EnvironmentFile. Values are double quoted with
+// the characters systemd treats as special escaped
+func renderSystemd(d *Dotenv) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+
+	var b strings.Builder
+	vars := d.Map()
+	for _, key := range d.Keys() {
+		fmt.Fprintf(&b, "%s=\"%s\"\n", key, r.Replace(vars[key]))
+	}
+	return b.String()
+}
+
+// renderDocker renders a file for `docker run --env-file`. Docker reads
+// values literally, so values spanning several lines cannot be exported
+func renderDocker(d *Dotenv) (string, error) {
+	var b strings.Builder
+	vars := d.Map()
+	for _, key := range d.Keys() {
+		if strings.ContainsAny(vars[key], "\r\n") {
+			return "", fmt.Errorf("%s spans several lines, docker env files cannot represent it", key)
+		}
+		fmt.Fprintf(&b, "%s=%s\n", key, vars[key])
+	}
+	return b.String(), nil
+}
+
+// kubernetesName turns an identifier into a valid resource name:
+// lowercase alphanumerics, '-' and '.'
+func kubernetesName(name string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(name) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-' || c == '.' {
+			b.WriteRune(c)
+		} else {
+			b.WriteByte('-')
+		}
+	}
+
+	s := strings.Trim(b.String(), "-.")
+	if s == "" {
+		return "env"
+	}
+	if len(s) > 253 {
+		s = strings.TrimRight(s[:253], "-.")
+	}
+	return s
+}
+
+func renderKubernetes(d *Dotenv, name string) string {
+	var b strings.Builder
+	b.WriteString("apiVersion: v1\n")
+	b.WriteString("kind: Secret\n")
+	b.WriteString("metadata:\n")
+	fmt.Fprintf(&b, "  name: %s\n", kubernetesName(name))
+	b.WriteString("type: Opaque\n")
+
+	keys := d.Keys()
+	if len(keys) == 0 {
+		b.WriteString("data: {}\n")
+		return b.String()
+	}
+
+	vars := d.Map()
+	b.WriteString("data:\n")
+	for _, key := range keys {
+		encoded := base64.StdEncoding.EncodeToString([]byte(vars[key]))
+		if encoded == "" {
+			encoded = `""`
+		}
+		fmt.Fprintf(&b, "  %s: %s\n", yamlKey(key), encoded)
+	}
+	return b.String()
+}
@@ -0,0 +1,112 @@
+package manager
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const EXPORT_FIXTURE = `#- identifier: Prod_EU
+#- restore-as: .env
+# comment
+API_KEY="it's \"quoted\" $HOME"
+MULTI="line1\nline2"
+EMPTY=
+`
+
+func TestRenderVariables(t *testing.T) {
+	d, err := ParseDotenv(EXPORT_FIXTURE)
+	if err != nil {
+		t.Fatalf("ParseDotenv() = %v, want %v", err, nil)
+	}
+
+	tests := map[string]string{
+		EXPORT_DOTENV:  "API_KEY=\"it's \\\"quoted\\\" $HOME\"\nMULTI=\"line1\\nline2\"\nEMPTY=\n",
+		EXPORT_JSON:    "{\n  \"API_KEY\": \"it's \\\"quoted\\\" $HOME\",\n  \"MULTI\": \"line1\\nline2\",\n  \"EMPTY\": \"\"\n}\n",
+		EXPORT_YAML:    "API_KEY: \"it's \\\"quoted\\\" $HOME\"\nMULTI: \"line1\\nline2\"\nEMPTY: \"\"\n",
+		EXPORT_SHELL:   "export API_KEY='it'\\''s \"quoted\" $HOME'\nexport MULTI='line1\nline2'\nexport EMPTY=''\n",
+		EXPORT_SYSTEMD: "API_KEY=\"it's \\\"quoted\\\" \\$HOME\"\nMULTI=\"line1\nline2\"\nEMPTY=\"\"\n",
+		EXPORT_KUBERNETES: `apiVersion: v1
+kind: Secret
+metadata:
+  name: prod-eu
+type: Opaque
+data:
+  API_KEY: aXQncyAicXVvdGVkIiAkSE9NRQ==
+  MULTI: bGluZTEKbGluZTI=
+  EMPTY: ""
+`,
+	}
+
+	for format, want := range tests {
+		got, err := RenderVariables(d, format, "Prod_EU")
+		if err != nil {
+			t.Fatalf("RenderVariables(%s) = %v, want %v", format, err, nil)
+		}
+		if got != want {
+			t.Errorf("RenderVariables(%s) = %q, want %q", format, got, want)
+		}
+	}
+
+	// JSON output is valid
+	rendered, _ := RenderVariables(d, EXPORT_JSON, "")
+	var decoded map[string]string
+	if err := json.Unmarshal([]byte(rendered), &decoded); err != nil || decoded["MULTI"] != "line1\nline2" {
+		t.Errorf("RenderVariables(json) is not valid JSON: %v", err)
+	}
+
+	// Docker env files cannot hold multi-line values
+	if _, err := RenderVariables(d, EXPORT_DOCKER, ""); err == nil {
+		t.Errorf("RenderVariables(docker) accepted a multi-line value")
+	}
+
+	// A shell cannot source keys with dots or dashes
+	for _, content := range []string{"A.B=1\n", "A-B=1\n"} {
+		invalid, _ := ParseDotenv(content)
+		if _, err := RenderVariables(invalid, EXPORT_SHELL, ""); err == nil {
+			t.Errorf("RenderVariables(shell) accepted %q", content)
+		}
+	}
+
+	if _, err := RenderVariables(d, "toml", ""); err == nil {
+		t.Errorf("RenderVariables(toml) accepted an unknown format")
+	}
+}
+
+func TestRenderVariablesYAMLKeys(t *testing.T) {
+	keys := []string{"-A", ".inf", ".NaN", "A.B", "A-B", "no", "Y", "null", "PLAIN_1"}
+	content := ""
+	for _, key := range keys {
+		content += key + "=" + key + "\n"
+	}
+	d, err := ParseDotenv(content)
+	if err != nil {
+		t.Fatalf("ParseDotenv() = %v, want %v", err, nil)
+	}
+
+	rendered, _ := RenderVariables(d, EXPORT_YAML, "")
+	// Keys that are not read back as strings are not found in the map
+	var decoded map[any]any
+	if err := yaml.Unmarshal([]byte(rendered), &decoded); err != nil {
+		t.Fatalf("RenderVariables(yaml) is not valid YAML: %v\n%s", err, rendered)
+	}
+
+	rendered, _ = RenderVariables(d, EXPORT_KUBERNETES, "test")
+	var secret struct {
+		Data map[any]string `yaml:"data"`
+	}
+	if err := yaml.Unmarshal([]byte(rendered), &secret); err != nil {
+		t.Fatalf("RenderVariables(kubernetes) is not valid YAML: %v\n%s", err, rendered)
+	}
+
+	for _, key := range keys {
+		if decoded[key] != key {
+			t.Errorf("RenderVariables(yaml) %s = %v, want %v", key, decoded[key], key)
+		}
+		if value, _ := base64.StdEncoding.DecodeString(secret.Data[key]); string(value) != key {
+			t.Errorf("RenderVariables(kubernetes) %s = %q, want %q", key, value, key)
+		}
+	}
+}
@@ -1,103 +1,325 @@
 package manager
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"slices"
+	"time"
 )
 
+// Name of the manifest in the store
+const MANIFEST_FILE = "manifest.json"
+
+// Times a manifest change is applied again after a concurrent write
+const MANIFEST_RETRIES = 5
+
+// Version of the manifest format written by this version
+const MANIFEST_VERSION = 2
+
 type EnvFilePath string
 type EnvFileIdentifier string
 
+// ManifestEntry describes a stored configuration
+type ManifestEntry struct {
+	RestoreAs   string    `json:"restore_as,omitempty"`
+	SourcePath  string    `json:"source_path,omitempty"` // File it was created from
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Checksum    string    `json:"checksum,omitempty"` // sha256 of the encrypted file
+	Description string    `json:"description,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+}
+
 type Manifest struct {
-	Identifiers map[EnvFilePath]EnvFileIdentifier `json:"identifiers"`
+	Version int                                  `json:"version"`
+	Entries map[EnvFileIdentifier]*ManifestEntry `json:"entries"`
+
+	// Source path to identifier map of version 1, only read to migrate it
+	Identifiers map[EnvFilePath]EnvFileIdentifier `json:"identifiers,omitempty"`
 }
 
-func (m *Manifest) Write(folderPath string) error {
-	manifestPath := fmt.Sprintf("%s/%s", folderPath, "manifest.json")
-	f, err := os.Create(manifestPath)
+func (m *Manifest) Write(store Store) error {
+	data, err := json.MarshalIndent(m, "", "  ")
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	encoder := json.NewEncoder(f)
-	encoder.SetIndent("", "  ")
-	return encoder.Encode(m)
+	return store.WriteFile(MANIFEST_FILE, append(data, '\n'))
 }
 
-func (m *Manifest) Load(folderPath string) error {
-	manifestPath := fmt.Sprintf("%s/%s", folderPath, "manifest.json")
-	f, err := os.Open(manifestPath)
+// Load reads the manifest and migrates older versions in memory. The
+// migrated manifest is saved by the next command that changes the folder
+func (m *Manifest) Load(store Store) error {
+	data, err := store.ReadFile(MANIFEST_FILE)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	err = json.NewDecoder(f).Decode(m)
-	if err != nil {
+	if err := json.Unmarshal(data, m); err != nil {
 		return err
 	}
+
+	if m.Version > MANIFEST_VERSION {
+		return fmt.Errorf("%w: %s version %d, upgrade env-manager", ErrUnsupportedFormat, MANIFEST_FILE, m.Version)
+	}
+	if m.Version < MANIFEST_VERSION {
+		m.migrate(store)
+	}
 	return nil
 }
 
-func (m *Manifest) addFileIdentifier(filePath EnvFilePath, identifier EnvFileIdentifier, folderPath string) error {
-	if m.Identifiers == nil {
-		m.Identifiers = make(map[EnvFilePath]EnvFileIdentifier)
+// migrate converts a version 1 manifest. The times and checksum come from
+// the encrypted files; the restore-as is filled in when a file is saved
+func (m *Manifest) migrate(store Store) {
+	if m.Entries == nil {
+		m.Entries = make(map[EnvFileIdentifier]*ManifestEntry)
 	}
-	m.Identifiers[filePath] = identifier
-	return m.Write(folderPath)
+
+	// Sorted so the source path kept for an identifier is always the same
+	paths := make([]EnvFilePath, 0, len(m.Identifiers))
+	for path := range m.Identifiers {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+
+	for _, path := range paths {
+		id := m.Identifiers[path]
+		if _, ok := m.Entries[id]; ok {
+			continue
+		}
+
+		entry := &ManifestEntry{SourcePath: string(path)}
+		if content, err := store.ReadFile(storedName(string(id))); err == nil {
+			entry.Checksum = checksum(content)
+			if env, err := DecodeEnvelope(string(content)); err == nil {
+				entry.CreatedAt = env.CreatedAt
+				entry.UpdatedAt = env.UpdatedAt
+			}
+		}
+		m.Entries[id] = entry
+	}
+
+	logf("Migrated %s from version %d to %d\n", MANIFEST_FILE, max(m.Version, 1), MANIFEST_VERSION)
+	m.Version = MANIFEST_VERSION
+	m.Identifiers = nil
 }
 
-func (m *Manifest) EvictFileIdentifier(filePath EnvFilePath, folderPath string) error {
-	if m.Identifiers != nil {
-		delete(m.Identifiers, filePath)
-		return m.Write(folderPath)
+// EvictFileIdentifier removes the configurations created from filePath
+func (m *Manifest) EvictFileIdentifier(filePath EnvFilePath, store Store) error {
+	m.evict(filePath)
+	return m.Write(store)
+}
+
+func (m *Manifest) evict(filePath EnvFilePath) {
+	for id, entry := range m.Entries {
+		if entry.SourcePath == string(filePath) {
+			delete(m.Entries, id)
+		}
 	}
-	return nil
+}
+
+// entry returns the entry of identifier, adding it if needed
+func (m *Manifest) entry(identifier EnvFileIdentifier) *ManifestEntry {
+	entry, ok := m.Entries[identifier]
+	if !ok {
+		now := time.Now().UTC()
+		entry = &ManifestEntry{CreatedAt: now, UpdatedAt: now}
+		m.Entries[identifier] = entry
+	}
+	return entry
+}
+
+// checksum is the hex sha256 of an encrypted file
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
 }
 
 type Folder struct {
 	manifest   *Manifest
-	FolderPath string
+	store      Store
+	FolderPath string // Shown in messages, empty for stores without a path
+}
+
+func (f *Folder) Store() Store {
+	return f.store
 }
 
+// AddFileIdentifier records that the configuration was created from filePath
 func (f *Folder) AddFileIdentifier(filePath EnvFilePath, identifier EnvFileIdentifier) error {
-	return f.manifest.addFileIdentifier(filePath, identifier, f.FolderPath)
+	return f.updateManifest(func(m *Manifest) {
+		m.entry(identifier).SourcePath = string(filePath)
+	})
 }
 
+// EvictFileIdentifier forgets the configurations created from filePath.
+// Their encrypted files are kept
 func (f *Folder) EvictFileIdentifier(filePath EnvFilePath) error {
-	return f.manifest.EvictFileIdentifier(filePath, f.FolderPath)
+	return f.updateManifest(func(m *Manifest) {
+		m.evict(filePath)
+	})
+}
+
+// Describe sets the description and tags of a configuration. An empty
+// description or nil tags keep the current ones
+func (f *Folder) Describe(identifier string, description string, tags []string) error {
+	if !f.hasIdentifier(identifier) {
+		return fmt.Errorf("%w: invalid identifier - %s", ErrNotFound, identifier)
+	}
+
+	return f.updateManifest(func(m *Manifest) {
+		entry := m.entry(EnvFileIdentifier(identifier))
+		if description != "" {
+			entry.Description = description
+		}
+		if tags != nil {
+			entry.Tags = tags
+		}
+	})
+}
+
+// recordSaved updates the entry of a configuration that was just written
+func (f *Folder) recordSaved(e *EnvFile) error {
+	return f.updateManifest(func(m *Manifest) {
+		entry := m.entry(EnvFileIdentifier(e.header.Identifier))
+		entry.RestoreAs = e.header.RestoreAs
+		entry.Checksum = checksum([]byte(e.encrypted))
+		entry.UpdatedAt = e.envelope.UpdatedAt
+		if !e.envelope.CreatedAt.IsZero() {
+			entry.CreatedAt = e.envelope.CreatedAt
+		}
+	})
+}
+
+// recordReplaced updates the checksums of configurations re-encrypted by
+// replaceFiles
+func (f *Folder) recordReplaced(files []*replacedFile) error {
+	return f.updateManifest(func(m *Manifest) {
+		for _, r := range files {
+			if entry, ok := m.Entries[EnvFileIdentifier(r.identifier)]; ok && r.identifier != "" {
+				entry.Checksum = checksum([]byte(r.content))
+			}
+		}
+	})
 }
 
-func (f *Folder) GetIdentifiers() map[EnvFilePath]EnvFileIdentifier {
-	return f.manifest.Identifiers
+// updateManifest applies change to the manifest and writes it. When the
+// store reports that someone else wrote the manifest meanwhile, it is read
+// again and the change applied on top of the new version
+func (f *Folder) updateManifest(change func(m *Manifest)) error {
+	for attempt := 0; ; attempt++ {
+		change(f.manifest)
+		err := f.manifest.Write(f.store)
+		if !errors.Is(err, ErrConflict) || attempt == MANIFEST_RETRIES {
+			return err
+		}
+
+		logf("%s changed concurrently, retrying\n", MANIFEST_FILE)
+		if err := f.loadManifest(); err != nil {
+			return err
+		}
+	}
 }
 
+// loadManifest reads the manifest from the store. A store without
+// manifest is an empty folder
+func (f *Folder) loadManifest() error {
+	m := &Manifest{}
+	err := m.Load(f.store)
+	if errors.Is(err, fs.ErrNotExist) {
+		m.Version = MANIFEST_VERSION
+	} else if err != nil {
+		return fmt.Errorf("reading %s: %w", MANIFEST_FILE, err)
+	}
+	if m.Entries == nil {
+		m.Entries = make(map[EnvFileIdentifier]*ManifestEntry)
+	}
+	f.manifest = m
+	return nil
+}
+
+// Identifiers returns the identifiers of the folder in sorted order
+func (f *Folder) Identifiers() []string {
+	ids := make([]string, 0, len(f.manifest.Entries))
+	for id := range f.manifest.Entries {
+		ids = append(ids, string(id))
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// Entry returns a copy of the manifest entry of identifier
+func (f *Folder) Entry(identifier string) (ManifestEntry, bool) {
+	entry, ok := f.manifest.Entries[EnvFileIdentifier(identifier)]
+	if !ok {
+		return ManifestEntry{}, false
+	}
+	copied := *entry
+	copied.Tags = slices.Clone(entry.Tags)
+	return copied, true
+}
+
+// hasIdentifier reports whether the manifest lists the identifier
+func (f *Folder) hasIdentifier(identifier string) bool {
+	_, ok := f.manifest.Entries[EnvFileIdentifier(identifier)]
+	return ok
+}
+
+// RemoveEnvFile deletes a configuration, its history and its manifest entry
+func (f *Folder) RemoveEnvFile(identifier string) error {
+	if !f.hasIdentifier(identifier) {
+		return fmt.Errorf("%w: invalid identifier - %s", ErrNotFound, identifier)
+	}
+
+	err := f.updateManifest(func(m *Manifest) {
+		delete(m.Entries, EnvFileIdentifier(identifier))
+	})
+	if err != nil {
+		return err
+	}
+
+	logf("Removing file: %s\n", storedName(identifier))
+	if err := f.store.Remove(storedName(identifier)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := f.store.Remove(historyName(identifier)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+/// Functions
+
+// OpenFolder reads the manifest of a store. A store without manifest
+// is an empty folder
+func OpenFolder(store Store) (*Folder, error) {
+	folder := &Folder{store: store}
+	if s, ok := store.(fmt.Stringer); ok {
+		folder.FolderPath = s.String()
+	}
+
+	if err := folder.loadManifest(); err != nil {
+		return nil, err
+	}
+	return folder, nil
+}
+
+// GetOrCreateFolder opens the local folder, creating it if needed
 func GetOrCreateFolder(folderName *string) (*Folder, error) {
-	fmt.Println("Creating init folder... ")
 	// Check if folder exists
 	// If not, create it
 	if _, err := os.Stat(*folderName); os.IsNotExist(err) {
-		fmt.Printf("\nFolder does not exist: %s\n", *folderName)
-		fmt.Println("\nCreating folder... ")
+		logf("Creating folder: %s\n", *folderName)
 		err := os.Mkdir(*folderName, 0755)
 		if err != nil {
-			fmt.Println("Error creating folder")
-			fmt.Println(err)
 			return nil, err
 		}
 	} else {
-		fmt.Printf("Folder exists: %s\n", *folderName)
-	}
-
-	folder := &Folder{
-		manifest: &Manifest{
-			Identifiers: make(map[EnvFilePath]EnvFileIdentifier),
-		},
-		FolderPath: *folderName,
+		logf("Folder exists: %s\n", *folderName)
 	}
 
-	// Try to load existing manifest
-	folder.manifest.Load(folder.FolderPath)
-
-	return folder, nil
+	return OpenFolder(NewDirStore(*folderName))
 }
@@ -0,0 +1,126 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestManifestEntries(t *testing.T) {
+	f := newTestFolder(t)
+
+	// Two configurations created from the same file are both kept
+	for _, id := range []string{"staging", "production"} {
+		e := InitEnvFile(id, ".env."+id)
+		e.SetContent("A=1\n")
+		if err := f.SaveEnvFile(e, TEST_SECRET); err != nil {
+			t.Fatalf("SaveEnvFile() = %v, want %v", err, nil)
+		}
+		f.AddFileIdentifier(EnvFilePath("secrets.txt"), EnvFileIdentifier(id))
+	}
+
+	if ids := f.Identifiers(); strings.Join(ids, ",") != "production,staging" {
+		t.Errorf("Identifiers() = %v, want %v", ids, []string{"production", "staging"})
+	}
+
+	entry, ok := f.Entry("production")
+	if !ok {
+		t.Fatalf("Entry() = %v, want %v", ok, true)
+	}
+	stored, _ := f.Store().ReadFile(storedName("production"))
+	if entry.RestoreAs != ".env.production" || entry.SourcePath != "secrets.txt" || entry.Checksum != checksum(stored) || entry.CreatedAt.IsZero() {
+		t.Errorf("Entry() = %+v, want restore-as, source path, checksum and times", entry)
+	}
+	created := entry.CreatedAt
+
+	if err := f.Describe("production", "Production cluster", []string{"k8s", "eu"}); err != nil {
+		t.Fatalf("Describe() = %v, want %v", err, nil)
+	}
+	if err := f.Describe("missing", "", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Describe() = %v, want %v", err, ErrNotFound)
+	}
+
+	// Saving again keeps the creation time and the description
+	if err := f.SetVariable("production", "A", "2", TEST_SECRET); err != nil {
+		t.Fatalf("SetVariable() = %v, want %v", err, nil)
+	}
+
+	reopened, err := OpenFolder(f.Store())
+	if err != nil {
+		t.Fatalf("OpenFolder() = %v, want %v", err, nil)
+	}
+	entry, _ = reopened.Entry("production")
+	stored, _ = f.Store().ReadFile(storedName("production"))
+	if !entry.CreatedAt.Equal(created) || entry.Description != "Production cluster" || strings.Join(entry.Tags, ",") != "k8s,eu" {
+		t.Errorf("Entry() after save = %+v, want the creation time and description kept", entry)
+	}
+	if entry.Checksum != checksum(stored) {
+		t.Errorf("Entry() checksum = %s, want %s", entry.Checksum, checksum(stored))
+	}
+
+	// Rotation changes every file, and so every checksum
+	if err := reopened.RotateSecret(TEST_SECRET, ROTATED_SECRET); err != nil {
+		t.Fatalf("RotateSecret() = %v, want %v", err, nil)
+	}
+	for _, id := range reopened.Identifiers() {
+		entry, _ := reopened.Entry(id)
+		stored, _ := f.Store().ReadFile(storedName(id))
+		if entry.Checksum != checksum(stored) {
+			t.Errorf("Entry(%s) checksum after rotation = %s, want %s", id, entry.Checksum, checksum(stored))
+		}
+	}
+}
+
+func TestManifestMigration(t *testing.T) {
+	store := NewMemoryStore()
+	f, _ := OpenFolder(store)
+	saveTestEnvFile(t, f, "production", TEST_SECRET, "A=1\n")
+	stored, _ := store.ReadFile(storedName("production"))
+
+	store.WriteFile(MANIFEST_FILE, []byte(`{"identifiers": {"b.env": "production", "a.env": "production", "gone.env": "gone"}}`))
+
+	f, err := OpenFolder(store)
+	if err != nil {
+		t.Fatalf("OpenFolder() = %v, want %v", err, nil)
+	}
+	if ids := f.Identifiers(); strings.Join(ids, ",") != "gone,production" {
+		t.Errorf("Identifiers() = %v, want %v", ids, []string{"gone", "production"})
+	}
+
+	entry, _ := f.Entry("production")
+	if entry.SourcePath != "a.env" || entry.Checksum != checksum(stored) || entry.CreatedAt.IsZero() {
+		t.Errorf("Entry() = %+v, want source path, checksum and times", entry)
+	}
+
+	// Opening the folder does not write to the store
+	data, _ := store.ReadFile(MANIFEST_FILE)
+	var m Manifest
+	json.Unmarshal(data, &m)
+	if m.Version == MANIFEST_VERSION {
+		t.Errorf("OpenFolder() wrote %s = %s, want it unchanged", MANIFEST_FILE, data)
+	}
+
+	// The next save writes the migrated manifest, with restore-as known again
+	if err := f.SetVariable("production", "A", "2", TEST_SECRET); err != nil {
+		t.Fatalf("SetVariable() = %v, want %v", err, nil)
+	}
+	if entry, _ := f.Entry("production"); entry.RestoreAs != DEFAULT_RESTORE_AS {
+		t.Errorf("Entry() restore-as = %q, want %q", entry.RestoreAs, DEFAULT_RESTORE_AS)
+	}
+	data, _ = store.ReadFile(MANIFEST_FILE)
+	m = Manifest{}
+	json.Unmarshal(data, &m)
+	if m.Version != MANIFEST_VERSION || m.Identifiers != nil || len(m.Entries) != 2 {
+		t.Errorf("%s = %s, want version %d with entries", MANIFEST_FILE, data, MANIFEST_VERSION)
+	}
+}
+
+func TestManifestNewerVersion(t *testing.T) {
+	store := NewMemoryStore()
+	store.WriteFile(MANIFEST_FILE, []byte(`{"version": 99, "entries": {}}`))
+
+	if _, err := OpenFolder(store); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("OpenFolder() = %v, want %v", err, ErrUnsupportedFormat)
+	}
+}
@@ -0,0 +1,158 @@
+package manager
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const GITIGNORE_FILE = ".gitignore"
+
+// Comment written above the entries added to .gitignore
+const GITIGNORE_COMMENT = "# env-manager: secret and decrypted configurations"
+
+// RestoreTargets returns the files the configurations of the folder are
+// restored as, read from the manifest and, with secret, from their headers
+func (f *Folder) RestoreTargets(secret string) ([]string, error) {
+	targets := []string{DEFAULT_RESTORE_AS}
+	for _, id := range f.Identifiers() {
+		if entry, _ := f.Entry(id); entry.RestoreAs != "" {
+			targets = append(targets, entry.RestoreAs)
+		}
+	}
+	if secret == "" {
+		return uniquePaths(targets), nil
+	}
+
+	envFiles, err := f.GetEnvFiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range envFiles {
+		if err := DecryptEnvFile(e, secret); err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Identifier(), err)
+		}
+		targets = append(targets, e.header.RestoreAs)
+	}
+
+	return uniquePaths(targets), nil
+}
+
+// uniquePaths cleans the paths and drops duplicates and paths outside
+// the working directory, which .gitignore cannot match
+func uniquePaths(paths []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, p := range paths {
+		p = filepath.ToSlash(filepath.Clean(p))
+		if filepath.IsAbs(p) || p == "." || p == ".." || strings.HasPrefix(p, "../") || seen[p] {
+			continue
+		}
+		seen[p] = true
+		unique = append(unique, p)
+	}
+	return unique
+}
+
+// UpdateGitignore adds the entries missing from the .gitignore file in
+// dir and returns them. Entries are anchored to dir, so that a restore
+// target does not also match the stored file of the same name. The file
+// is created if needed
+func UpdateGitignore(dir string, entries []string) ([]string, error) {
+	path := filepath.Join(dir, GITIGNORE_FILE)
+	content, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	existing := make(map[string]bool)
+	for _, line := range strings.Split(string(content), "\n") {
+		existing[strings.TrimPrefix(strings.TrimSpace(line), "/")] = true
+	}
+
+	var added []string
+	for _, entry := range uniquePaths(entries) {
+		if !existing[entry] {
+			added = append(added, "/"+entry)
+		}
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+
+	var b bytes.Buffer
+	b.Write(content)
+	if len(content) > 0 && !bytes.HasSuffix(content, []byte("\n")) {
+		b.WriteByte('\n')
+	}
+	// Later additions go below the block of the first run
+	if !existing[GITIGNORE_COMMENT] {
+		if len(content) > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(GITIGNORE_COMMENT + "\n")
+	}
+	for _, entry := range added {
+		b.WriteString(entry + "\n")
+	}
+
+	if err := WriteFileAtomic(path, b.Bytes(), 0644); err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+// IgnoresFolder reports whether the .gitignore file in dir ignores the
+// env-manager folder, which holds only encrypted files and can be shared
+func IgnoresFolder(dir string, folder string) bool {
+	content, err := os.ReadFile(filepath.Join(dir, GITIGNORE_FILE))
+	if err != nil {
+		return false
+	}
+	folder = filepath.ToSlash(filepath.Clean(folder))
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(line), "/"), "/")
+		if line == folder {
+			return true
+		}
+	}
+	return false
+}
+
+// TrackedFiles returns the paths that git tracks in dir. Outside a
+// repository, or without git, nothing is tracked
+func TrackedFiles(dir string, paths []string) ([]string, error) {
+	paths = uniquePaths(paths)
+	if len(paths) == 0 {
+		return nil, nil
+	}
+
+	args := append([]string{"-C", dir, "ls-files", "-z", "--"}, paths...)
+	cmd := exec.Command("git", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		if strings.Contains(stderr.String(), "not a git repository") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("git ls-files: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var tracked []string
+	for _, p := range strings.Split(string(out), "\x00") {
+		if p != "" {
+			tracked = append(tracked, p)
+		}
+	}
+	return tracked, nil
+}
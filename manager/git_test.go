@@ -0,0 +1,141 @@
+package manager
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpdateGitignore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, GITIGNORE_FILE)
+	os.WriteFile(path, []byte("node_modules\n/.env"), 0644)
+
+	added, err := UpdateGitignore(dir, []string{DOT_SECRET, ".env", "./config/.env.local", ".secret", "../outside"})
+	if err != nil {
+		t.Fatalf("UpdateGitignore() = %v, want %v", err, nil)
+	}
+	if strings.Join(added, ",") != "/.secret,/config/.env.local" {
+		t.Errorf("UpdateGitignore() = %v, want %v", added, "[/.secret /config/.env.local]")
+	}
+
+	content, _ := os.ReadFile(path)
+	want := "node_modules\n/.env\n\n" + GITIGNORE_COMMENT + "\n/.secret\n/config/.env.local\n"
+	if string(content) != want {
+		t.Errorf("UpdateGitignore() content = %q, want %q", content, want)
+	}
+
+	// Running again changes nothing
+	added, err = UpdateGitignore(dir, []string{DOT_SECRET, ".env"})
+	if err != nil || len(added) != 0 {
+		t.Errorf("UpdateGitignore() = %v, %v, want nothing added", added, err)
+	}
+
+	// New targets join the existing block
+	UpdateGitignore(dir, []string{".env.staging"})
+	content, _ = os.ReadFile(path)
+	if want += "/.env.staging\n"; string(content) != want {
+		t.Errorf("UpdateGitignore() content = %q, want %q", content, want)
+	}
+}
+
+func TestUpdateGitignoreAnchorsEntries(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, GITIGNORE_FILE)
+	os.WriteFile(path, []byte("node_modules\n"), 0644)
+
+	if _, err := UpdateGitignore(dir, []string{DOT_SECRET, ".env.local"}); err != nil {
+		t.Fatalf("UpdateGitignore() = %v, want %v", err, nil)
+	}
+	content, _ := os.ReadFile(path)
+	if want := "node_modules\n\n" + GITIGNORE_COMMENT + "\n/.secret\n/.env.local\n"; string(content) != want {
+		t.Errorf("UpdateGitignore() content = %q, want %q", content, want)
+	}
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	if out, err := exec.Command("git", "-C", dir, "init", "-q").CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+
+	// The restore target is ignored, the stored file of the same name is not
+	checkIgnore := func(name string) bool {
+		return exec.Command("git", "-C", dir, "check-ignore", "-q", name).Run() == nil
+	}
+	if !checkIgnore(".env.local") {
+		t.Errorf("git check-ignore .env.local = %v, want %v", false, true)
+	}
+	if stored := DEFAULT_ENV_FOLDER + "/" + storedName("local"); checkIgnore(stored) {
+		t.Errorf("git check-ignore %s = %v, want %v", stored, true, false)
+	}
+}
+
+func TestIgnoresFolder(t *testing.T) {
+	dir := t.TempDir()
+	if IgnoresFolder(dir, DEFAULT_ENV_FOLDER) {
+		t.Errorf("IgnoresFolder() without .gitignore = %v, want %v", true, false)
+	}
+
+	os.WriteFile(filepath.Join(dir, GITIGNORE_FILE), []byte("/.env-manager/\n"), 0644)
+	if !IgnoresFolder(dir, DEFAULT_ENV_FOLDER) {
+		t.Errorf("IgnoresFolder() = %v, want %v", false, true)
+	}
+}
+
+func TestTrackedFiles(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	if tracked, err := TrackedFiles(dir, []string{".env"}); err != nil || len(tracked) != 0 {
+		t.Errorf("TrackedFiles() outside a repository = %v, %v, want nothing", tracked, err)
+	}
+
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	git("init", "-q")
+	os.WriteFile(filepath.Join(dir, ".env"), []byte("A=1\n"), 0644)
+	os.WriteFile(filepath.Join(dir, DOT_SECRET), []byte("secret\n"), 0644)
+	git("add", ".env")
+
+	tracked, err := TrackedFiles(dir, []string{DOT_SECRET, ".env", ".env.production"})
+	if err != nil {
+		t.Fatalf("TrackedFiles() = %v, want %v", err, nil)
+	}
+	if strings.Join(tracked, ",") != ".env" {
+		t.Errorf("TrackedFiles() = %v, want %v", tracked, "[.env]")
+	}
+}
+
+func TestRestoreTargets(t *testing.T) {
+	f := newTestFolder(t)
+	saveTestEnvFile(t, f, "production", TEST_SECRET, "HELLO=WORLD\n")
+
+	e := InitEnvFile("staging", "config/.env.staging")
+	e.SetContent("HELLO=STAGING\n")
+	f.AddFileIdentifier(EnvFilePath("staging"), EnvFileIdentifier("staging"))
+	if err := f.SaveEnvFile(e, TEST_SECRET); err != nil {
+		t.Fatalf("SaveEnvFile() = %v, want %v", err, nil)
+	}
+
+	targets, err := f.RestoreTargets(TEST_SECRET)
+	if err != nil {
+		t.Fatalf("RestoreTargets() = %v, want %v", err, nil)
+	}
+	if len(targets) != 2 || targets[0] != DEFAULT_RESTORE_AS {
+		t.Errorf("RestoreTargets() = %v, want %v and config/.env.staging", targets, DEFAULT_RESTORE_AS)
+	}
+
+	// The manifest keeps the targets for when there is no secret
+	if without, _ := f.RestoreTargets(""); strings.Join(without, ",") != strings.Join(targets, ",") {
+		t.Errorf("RestoreTargets() without secret = %v, want %v", without, targets)
+	}
+}
@@ -1,7 +1,7 @@
 package manager
 
 import (
-	"errors"
+	"fmt"
 	"strings"
 )
 
@@ -36,11 +36,11 @@ func InitHeader(text string) (*Header, error) {
 	}
 
 	if identifier == "" {
-		return nil, errors.New("invalid header: identifier not found")
+		return nil, fmt.Errorf("%w: identifier not found", ErrHeaderMissing)
 	}
 
 	if restoreAs == "" {
-		return nil, errors.New("invalid header: restore-as not found")
+		return nil, fmt.Errorf("%w: restore-as not found", ErrHeaderMissing)
 	}
 
 	return &Header{
@@ -0,0 +1,260 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"time"
+)
+
+// Folder of the store holding the revision log of each configuration
+const HISTORY_DIR = "history"
+
+// Environment variable naming the author of the revisions saved
+const ENV_AUTHOR = "ENV_MANAGER_AUTHOR"
+
+// Revision is one saved version of a configuration. The content is kept
+// encrypted like the configuration itself
+type Revision struct {
+	Number    int       `json:"revision"`
+	CreatedAt time.Time `json:"created_at"`
+	Author    string    `json:"author,omitempty"`
+	Encrypted string    `json:"encrypted"`
+}
+
+// revisionLog is the history file of a configuration, oldest first
+type revisionLog struct {
+	Revisions []*Revision `json:"revisions"`
+}
+
+// RevisionInfo describes a revision without its values
+type RevisionInfo struct {
+	Number    int
+	CreatedAt time.Time
+	Author    string
+	Changes   []VariableChange // Compared with the previous revision, values left out
+}
+
+func historyName(identifier string) string {
+	return HISTORY_DIR + "/" + identifier + ".json"
+}
+
+// currentAuthor names who saves a revision: ENV_MANAGER_AUTHOR or the
+// system user
+func currentAuthor() string {
+	if author := os.Getenv(ENV_AUTHOR); author != "" {
+		return author
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
+}
+
+// readHistory reads the history file of a configuration. raw is nil when
+// there is none
+func (f *Folder) readHistory(identifier string) (log *revisionLog, raw []byte, err error) {
+	log = &revisionLog{}
+	raw, err = f.store.ReadFile(historyName(identifier))
+	if errors.Is(err, fs.ErrNotExist) {
+		return log, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := json.Unmarshal(raw, log); err != nil {
+		return nil, nil, fmt.Errorf("%w: %s: %v", ErrCorruptFile, historyName(identifier), err)
+	}
+	return log, raw, nil
+}
+
+// loadHistory reads the revisions of a configuration. A configuration
+// saved before histories were kept has its stored file as only revision
+func (f *Folder) loadHistory(identifier string) (*revisionLog, error) {
+	log, raw, err := f.readHistory(identifier)
+	if err != nil || raw != nil {
+		return log, err
+	}
+
+	current, err := f.store.ReadFile(storedName(identifier))
+	if errors.Is(err, fs.ErrNotExist) {
+		return log, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log.Revisions = append(log.Revisions, firstRevision(string(current)))
+	return log, nil
+}
+
+// firstRevision is the revision of a file saved before histories were kept
+func firstRevision(encrypted string) *Revision {
+	revision := &Revision{Number: 1, Encrypted: encrypted}
+	if env, err := DecodeEnvelope(encrypted); err == nil {
+		revision.CreatedAt = env.UpdatedAt
+	}
+	return revision
+}
+
+func (f *Folder) writeHistory(identifier string, log *revisionLog) error {
+	data, err := encodeHistory(log)
+	if err != nil {
+		return err
+	}
+	return f.store.WriteFile(historyName(identifier), data)
+}
+
+func encodeHistory(log *revisionLog) ([]byte, error) {
+	data, err := json.MarshalIndent(log, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// addRevision appends the encrypted file just saved to the history.
+// previous is the file it replaced, kept as first revision when the
+// configuration was saved before histories were kept
+func (f *Folder) addRevision(identifier string, previous string, encrypted string, createdAt time.Time) error {
+	for attempt := 0; ; attempt++ {
+		log, raw, err := f.readHistory(identifier)
+		if err != nil {
+			return err
+		}
+		if raw == nil && previous != "" {
+			log.Revisions = append(log.Revisions, firstRevision(previous))
+		}
+
+		number := 1
+		if n := len(log.Revisions); n > 0 {
+			number = log.Revisions[n-1].Number + 1
+		}
+		log.Revisions = append(log.Revisions, &Revision{
+			Number:    number,
+			CreatedAt: createdAt,
+			Author:    currentAuthor(),
+			Encrypted: encrypted,
+		})
+
+		err = f.writeHistory(identifier, log)
+		if !errors.Is(err, ErrConflict) || attempt == MANIFEST_RETRIES {
+			return err
+		}
+		logf("%s changed concurrently, retrying\n", historyName(identifier))
+	}
+}
+
+// replaceHistory re-encrypts every revision of a configuration with
+// reencrypt and returns the new history file, or nil if there is none
+func (f *Folder) replaceHistory(identifier string, reencrypt func(e *EnvFile) error) (*replacedFile, error) {
+	log, raw, err := f.readHistory(identifier)
+	if err != nil || raw == nil {
+		return nil, err
+	}
+
+	for _, revision := range log.Revisions {
+		e := newStoredEnvFile(f, identifier, revision.Encrypted)
+		if err := reencrypt(e); err != nil {
+			return nil, fmt.Errorf("%s revision %d: %w", identifier, revision.Number, err)
+		}
+		revision.Encrypted = e.encrypted
+	}
+
+	data, err := encodeHistory(log)
+	if err != nil {
+		return nil, err
+	}
+	return &replacedFile{
+		name:     historyName(identifier),
+		file:     historyName(identifier),
+		previous: string(raw),
+		content:  string(data),
+	}, nil
+}
+
+/// Functions
+
+// History decrypts every revision of a configuration in memory and
+// returns them oldest first, with the variables each one changed
+func (f *Folder) History(identifier string, secret string) ([]RevisionInfo, error) {
+	if !f.hasIdentifier(identifier) {
+		return nil, fmt.Errorf("%w: invalid identifier - %s", ErrNotFound, identifier)
+	}
+
+	log, err := f.loadHistory(identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []RevisionInfo
+	previous := &Dotenv{}
+	for _, revision := range log.Revisions {
+		e := newStoredEnvFile(f, identifier, revision.Encrypted)
+		if err := DecryptEnvFile(e, secret); err != nil {
+			return nil, fmt.Errorf("%s revision %d: %w", identifier, revision.Number, err)
+		}
+		d, err := e.Variables()
+		if err != nil {
+			return nil, fmt.Errorf("%s revision %d: %w", identifier, revision.Number, err)
+		}
+
+		changes := DiffVariables(previous, d)
+		for i := range changes {
+			changes[i].Old, changes[i].New = "", ""
+		}
+		infos = append(infos, RevisionInfo{
+			Number:    revision.Number,
+			CreatedAt: revision.CreatedAt,
+			Author:    revision.Author,
+			Changes:   changes,
+		})
+		previous = d
+	}
+
+	return infos, nil
+}
+
+// Rollback saves the content of an earlier revision as the current
+// configuration, which adds a new revision. It returns its number
+func (f *Folder) Rollback(identifier string, secret string, number int) (int, error) {
+	current, err := f.GetEnvFile(identifier)
+	if err != nil {
+		return 0, err
+	}
+
+	log, err := f.loadHistory(identifier)
+	if err != nil {
+		return 0, err
+	}
+
+	var revision *Revision
+	for _, r := range log.Revisions {
+		if r.Number == number {
+			revision = r
+		}
+	}
+	if revision == nil {
+		return 0, fmt.Errorf("%w: revision %d of %s", ErrNotFound, number, identifier)
+	}
+
+	e := newStoredEnvFile(f, identifier, revision.Encrypted)
+	if err := DecryptEnvFile(e, secret); err != nil {
+		return 0, fmt.Errorf("revision %d: %w", number, err)
+	}
+
+	// Keep the creation time of the configuration
+	e.envelope = current.envelope
+	if err := f.SaveEnvFile(e, secret); err != nil {
+		return 0, err
+	}
+
+	log, err = f.loadHistory(identifier)
+	if err != nil {
+		return 0, err
+	}
+	return log.Revisions[len(log.Revisions)-1].Number, nil
+}
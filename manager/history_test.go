@@ -0,0 +1,152 @@
+package manager
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// revisionKeys renders the changes of a revision like "+A ~B -C"
+func revisionKeys(info RevisionInfo) string {
+	var keys []string
+	for _, c := range info.Changes {
+		switch c.Kind {
+		case VARIABLE_ADDED:
+			keys = append(keys, "+"+c.Key)
+		case VARIABLE_CHANGED:
+			keys = append(keys, "~"+c.Key)
+		case VARIABLE_REMOVED:
+			keys = append(keys, "-"+c.Key)
+		}
+	}
+	return strings.Join(keys, " ")
+}
+
+func TestHistory(t *testing.T) {
+	t.Setenv(ENV_AUTHOR, "alice")
+	f := newTestFolder(t)
+	saveTestEnvFile(t, f, "staging", TEST_SECRET, "HELLO=ONE\nOLD=x\n")
+	saveTestEnvFile(t, f, "staging", TEST_SECRET, "HELLO=TWO\nNEW=y\n")
+
+	history, err := f.History("staging", TEST_SECRET)
+	if err != nil {
+		t.Fatalf("History() = %v, want %v", err, nil)
+	}
+	if len(history) != 2 {
+		t.Fatalf("History() = %d revisions, want 2", len(history))
+	}
+
+	tests := []struct {
+		number int
+		keys   string
+	}{
+		{1, "+HELLO +OLD"},
+		{2, "~HELLO -OLD +NEW"},
+	}
+	for i, tt := range tests {
+		info := history[i]
+		if info.Number != tt.number || revisionKeys(info) != tt.keys {
+			t.Errorf("History()[%d] = %d %q, want %d %q", i, info.Number, revisionKeys(info), tt.number, tt.keys)
+		}
+		if info.Author != "alice" || info.CreatedAt.IsZero() {
+			t.Errorf("History()[%d] author = %q at %v, want alice at a time", i, info.Author, info.CreatedAt)
+		}
+		for _, c := range info.Changes {
+			if c.Old != "" || c.New != "" {
+				t.Errorf("History()[%d] = %+v, want no values", i, c)
+			}
+		}
+	}
+
+	// The history is encrypted like the configuration
+	content, _ := f.Store().ReadFile(historyName("staging"))
+	if strings.Contains(string(content), "TWO") {
+		t.Errorf("SaveEnvFile() wrote plaintext to %s", historyName("staging"))
+	}
+
+	if _, err := f.History("missing", TEST_SECRET); !errors.Is(err, ErrNotFound) {
+		t.Errorf("History() = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestHistoryKeepsFileSavedWithoutHistory(t *testing.T) {
+	f := newTestFolder(t)
+	saveTestEnvFile(t, f, "staging", TEST_SECRET, "HELLO=ONE\n")
+	// As saved before histories were kept
+	f.Store().Remove(historyName("staging"))
+
+	history, err := f.History("staging", TEST_SECRET)
+	if err != nil || len(history) != 1 {
+		t.Fatalf("History() = %v, %v, want 1 revision", history, err)
+	}
+
+	saveTestEnvFile(t, f, "staging", TEST_SECRET, "HELLO=TWO\n")
+	history, err = f.History("staging", TEST_SECRET)
+	if err != nil || len(history) != 2 {
+		t.Fatalf("History() = %v, %v, want 2 revisions", history, err)
+	}
+	if keys := revisionKeys(history[1]); keys != "~HELLO" {
+		t.Errorf("History()[1] = %q, want %q", keys, "~HELLO")
+	}
+}
+
+func TestRollback(t *testing.T) {
+	f := newTestFolder(t)
+	saveTestEnvFile(t, f, "staging", TEST_SECRET, "HELLO=ONE\n")
+	saveTestEnvFile(t, f, "staging", TEST_SECRET, "HELLO=TWO\n")
+	created, _ := f.GetEnvFile("staging")
+
+	number, err := f.Rollback("staging", TEST_SECRET, 1)
+	if err != nil {
+		t.Fatalf("Rollback() = %v, want %v", err, nil)
+	}
+	if number != 3 {
+		t.Errorf("Rollback() = %d, want 3", number)
+	}
+
+	d, err := f.LoadVariables("staging", TEST_SECRET)
+	if err != nil {
+		t.Fatalf("LoadVariables() = %v, want %v", err, nil)
+	}
+	if value, _ := d.Get("HELLO"); value != "ONE" {
+		t.Errorf("HELLO = %q, want %q", value, "ONE")
+	}
+
+	e, _ := f.GetEnvFile("staging")
+	if !e.envelope.CreatedAt.Equal(created.envelope.CreatedAt) {
+		t.Errorf("Rollback() CreatedAt = %v, want %v", e.envelope.CreatedAt, created.envelope.CreatedAt)
+	}
+
+	if _, err := f.Rollback("staging", TEST_SECRET, 7); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Rollback() = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestRotateSecretReencryptsHistory(t *testing.T) {
+	f := newTestFolder(t)
+	saveTestEnvFile(t, f, "staging", TEST_SECRET, "HELLO=ONE\n")
+	saveTestEnvFile(t, f, "staging", TEST_SECRET, "HELLO=TWO\n")
+
+	if err := f.RotateSecret(TEST_SECRET, ROTATED_SECRET); err != nil {
+		t.Fatalf("RotateSecret() = %v, want %v", err, nil)
+	}
+
+	if history, err := f.History("staging", ROTATED_SECRET); err != nil || len(history) != 2 {
+		t.Errorf("History() = %v, %v, want 2 revisions", history, err)
+	}
+	if _, err := f.History("staging", TEST_SECRET); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("History() with old secret = %v, want %v", err, ErrDecryptionFailed)
+	}
+}
+
+func TestRemoveEnvFileRemovesHistory(t *testing.T) {
+	f := newTestFolder(t)
+	saveTestEnvFile(t, f, "staging", TEST_SECRET, "HELLO=ONE\n")
+
+	if err := f.RemoveEnvFile("staging"); err != nil {
+		t.Fatalf("RemoveEnvFile() = %v, want %v", err, nil)
+	}
+	if _, err := f.Store().ReadFile(historyName("staging")); err == nil {
+		t.Errorf("RemoveEnvFile() left %s", historyName("staging"))
+	}
+}
@@ -0,0 +1,218 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Formats a configuration can be imported from
+const IMPORT_DOTENV = "dotenv"
+const IMPORT_JSON = "json"
+const IMPORT_YAML = "yaml"
+const IMPORT_COMPOSE = "compose"
+
+var ImportFormats = []string{IMPORT_DOTENV, IMPORT_JSON, IMPORT_YAML, IMPORT_COMPOSE}
+
+// ImportVariables reads variables from content in the given format and
+// returns them as canonical dotenv content, one KEY=value per line.
+// service selects the service of a docker-compose file with several services.
+func ImportVariables(content string, format string, service string) (string, error) {
+	var d *Dotenv
+	var err error
+
+	switch format {
+	case IMPORT_DOTENV:
+		d, err = ParseDotenv(content)
+	case IMPORT_JSON:
+		d, err = importJSON(content)
+	case IMPORT_YAML:
+		d, err = importYAML(content)
+	case IMPORT_COMPOSE:
+		d, err = importCompose(content, service)
+	default:
+		return "", fmt.Errorf("unknown format %q, valid formats are %s", format, strings.Join(ImportFormats, ", "))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return renderDotenv(d), nil
+}
+
+// importJSON reads a flat JSON object, keeping the order of its keys
+func importJSON(content string) (*Dotenv, error) {
+	decoder := json.NewDecoder(strings.NewReader(content))
+	decoder.UseNumber()
+
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if token != json.Delim('{') {
+		return nil, errors.New("invalid JSON: expected an object")
+	}
+
+	d := &Dotenv{}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		key := token.(string)
+
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+
+		var value any
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+
+		var s string
+		switch v := value.(type) {
+		case string:
+			s = v
+		case nil:
+			s = ""
+		case bool, float64:
+			// Keep numbers exactly as written
+			s = string(raw)
+		default:
+			return nil, fmt.Errorf("%s: nested values are not supported", key)
+		}
+
+		if err := d.Set(key, s); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := decoder.Token(); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	return d, nil
+}
+
+// importYAML reads a flat YAML map
+func importYAML(content string) (*Dotenv, error) {
+	v, err := parseYAML(content)
+	if err != nil {
+		return nil, err
+	}
+
+	m, ok := v.(*yamlMap)
+	if !ok {
+		return nil, errors.New("invalid YAML: expected a map")
+	}
+
+	return dotenvFromYAMLMap(m)
+}
+
+func dotenvFromYAMLMap(m *yamlMap) (*Dotenv, error) {
+	d := &Dotenv{}
+	for _, key := range m.keys {
+		var s string
+		switch v := m.values[key].(type) {
+		case string:
+			s = v
+		case nil:
+			s = ""
+		default:
+			return nil, fmt.Errorf("%s: nested values are not supported", key)
+		}
+
+		if err := d.Set(key, s); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// importCompose reads the environment block of a docker-compose file, or
+// a bare `environment:` block. Both the map and the KEY=value list syntax
+// are supported
+func importCompose(content string, service string) (*Dotenv, error) {
+	v, err := parseYAML(content)
+	if err != nil {
+		return nil, err
+	}
+
+	root, ok := v.(*yamlMap)
+	if !ok {
+		return nil, errors.New("invalid compose file: expected a map")
+	}
+
+	environment, ok := root.get("environment")
+	if !ok {
+		environment, err = composeServiceEnvironment(root, service)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch env := environment.(type) {
+	case *yamlMap:
+		return dotenvFromYAMLMap(env)
+	case []any:
+		d := &Dotenv{}
+		for _, item := range env {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid environment entry %v", item)
+			}
+			key, value, ok := strings.Cut(s, "=")
+			if !ok {
+				return nil, fmt.Errorf("%s has no value, it is read from the shell by docker-compose", s)
+			}
+			if err := d.Set(key, value); err != nil {
+				return nil, err
+			}
+		}
+		return d, nil
+	default:
+		return &Dotenv{}, nil
+	}
+}
+
+func composeServiceEnvironment(root *yamlMap, service string) (any, error) {
+	services, ok := root.get("services")
+	if !ok {
+		return nil, errors.New("invalid compose file: no services or environment block")
+	}
+
+	servicesMap, ok := services.(*yamlMap)
+	if !ok {
+		return nil, errors.New("invalid compose file: services is not a map")
+	}
+
+	var withEnvironment []string
+	for _, name := range servicesMap.keys {
+		if s, ok := servicesMap.values[name].(*yamlMap); ok {
+			if _, ok := s.get("environment"); ok {
+				withEnvironment = append(withEnvironment, name)
+			}
+		}
+	}
+
+	if service == "" {
+		if len(withEnvironment) != 1 {
+			sort.Strings(withEnvironment)
+			return nil, fmt.Errorf("select a service with --service, services with an environment: %s", strings.Join(withEnvironment, ", "))
+		}
+		service = withEnvironment[0]
+	}
+
+	s, ok := servicesMap.values[service].(*yamlMap)
+	if !ok {
+		return nil, fmt.Errorf("service %s not found", service)
+	}
+
+	environment, _ := s.get("environment")
+	return environment, nil
+}
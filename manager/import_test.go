@@ -0,0 +1,125 @@
+package manager
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestImportVariables(t *testing.T) {
+	tests := []struct {
+		format  string
+		service string
+		content string
+		want    string
+	}{
+		{
+			IMPORT_JSON, "",
+			`{"DB_HOST": "localhost", "DB_PORT": 5432, "DEBUG": true, "EMPTY": null, "QUOTE": "say \"hi\""}`,
+			"DB_HOST=localhost\nDB_PORT=5432\nDEBUG=true\nEMPTY=\nQUOTE=\"say \\\"hi\\\"\"\n",
+		},
+		{
+			IMPORT_YAML, "",
+			"# secrets\nDB_HOST: localhost\nDB_PORT: 5432 # comment\nPASSWORD: 'it''s'\nURL: \"https://x.io/#a\"\nCERT: |\n  line1\n  line2\nEMPTY:\n",
+			"DB_HOST=localhost\nDB_PORT=5432\nPASSWORD=\"it's\"\nURL=\"https://x.io/#a\"\nCERT=\"line1\\nline2\\n\"\nEMPTY=\n",
+		},
+		{
+			IMPORT_COMPOSE, "",
+			"services:\n  web:\n    image: nginx\n    environment:\n      - API_KEY=abc\n      - URL=http://a:b@c\n  db:\n    image: postgres\n",
+			"API_KEY=abc\nURL=http://a:b@c\n",
+		},
+		{
+			IMPORT_COMPOSE, "db",
+			"services:\n  web:\n    environment:\n      API_KEY: abc\n  db:\n    environment:\n    - POSTGRES_PASSWORD=secret\n",
+			"POSTGRES_PASSWORD=secret\n",
+		},
+		{
+			IMPORT_COMPOSE, "",
+			"environment:\n  API_KEY: abc\n",
+			"API_KEY=abc\n",
+		},
+		{
+			IMPORT_DOTENV, "",
+			"# comment\nexport API_KEY='abc'\nDEBUG = true\n",
+			"API_KEY=abc\nDEBUG=true\n",
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := ImportVariables(tt.content, tt.format, tt.service)
+		if err != nil {
+			t.Fatalf("ImportVariables(%s) = %v, want %v", tt.format, err, nil)
+		}
+		if got != tt.want {
+			t.Errorf("ImportVariables(%s) = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestImportVariablesErrors(t *testing.T) {
+	tests := []struct {
+		format  string
+		service string
+		content string
+	}{
+		{IMPORT_JSON, "", `{"NESTED": {"A": 1}}`},
+		{IMPORT_JSON, "", `["A"]`},
+		{IMPORT_YAML, "", "NESTED:\n  A: 1\n"},
+		{IMPORT_YAML, "", "BAD KEY: 1\n"},
+		{IMPORT_COMPOSE, "", "services:\n  a:\n    environment:\n      A: 1\n  b:\n    environment:\n      B: 2\n"},
+		{IMPORT_COMPOSE, "", "services:\n  a:\n    environment:\n      - FROM_SHELL\n"},
+		{"toml", "", "A = 1"},
+	}
+
+	for _, tt := range tests {
+		if got, err := ImportVariables(tt.content, tt.format, tt.service); err == nil {
+			t.Errorf("ImportVariables(%s, %q) = %q, want error", tt.format, tt.content, got)
+		}
+	}
+}
+
+func TestParseYAML(t *testing.T) {
+	content := `defaults: &defaults
+  MODE: "0755"
+  VERSION: 1.10
+  EMPTY:
+web:
+  <<: *defaults
+  VERSION: 2.0
+  FLOW: {A: 1, B: two}
+`
+	v, err := parseYAML(content)
+	if err != nil {
+		t.Fatalf("parseYAML() = %v, want %v", err, nil)
+	}
+
+	web := v.(*yamlMap).values["web"].(*yamlMap)
+	if got := strings.Join(web.keys, ","); got != "MODE,VERSION,EMPTY,FLOW" {
+		t.Errorf("parseYAML() keys = %v, want %v", got, "MODE,VERSION,EMPTY,FLOW")
+	}
+	// Scalars are kept as written and keys of the mapping win over merged ones
+	if web.values["MODE"] != "0755" || web.values["VERSION"] != "2.0" || web.values["EMPTY"] != nil {
+		t.Errorf("parseYAML() values = %v", web.values)
+	}
+	if flow := web.values["FLOW"].(*yamlMap); flow.values["B"] != "two" {
+		t.Errorf("parseYAML() flow mapping = %v", flow.values)
+	}
+
+	if _, err := parseYAML("a:\n\tb: 1\n"); err == nil {
+		t.Errorf("parseYAML() accepted tab indentation")
+	}
+}
+
+func TestParseYAMLAliasExpansion(t *testing.T) {
+	// Each level refers nine times to the previous one
+	content := "a: &a [x, x, x, x, x, x, x, x, x]\n"
+	for i, prev := 1, "a"; i < 9; i++ {
+		name := fmt.Sprintf("l%d", i)
+		content += fmt.Sprintf("%s: &%s [*%s, *%s, *%s, *%s, *%s, *%s, *%s, *%s, *%s]\n", name, name, prev, prev, prev, prev, prev, prev, prev, prev, prev)
+		prev = name
+	}
+
+	if _, err := parseYAML(content); err == nil {
+		t.Errorf("parseYAML() = nil, want an error for nested aliases")
+	}
+}
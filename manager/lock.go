@@ -0,0 +1,70 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Lock file inside the env-manager folder
+const LOCK_FILE = ".lock"
+
+// How long to wait for another env-manager process to release the store
+const LOCK_TIMEOUT = 10 * time.Second
+
+// How often a locked store is tried again
+const LOCK_POLL_INTERVAL = 50 * time.Millisecond
+
+// Returned when another process holds the store lock past the timeout
+var ErrLocked = errors.New("store is locked")
+
+// Locker is implemented by stores that can be locked across processes.
+// Lock waits up to timeout and returns the function releasing the lock
+type Locker interface {
+	Lock(timeout time.Duration) (func() error, error)
+}
+
+// Lock takes the lock of a local folder, so that concurrent env-manager
+// processes do not interleave their changes. The manifest is read again
+// once the lock is held. Stores without lock return a no-op; the S3 store
+// relies on conditional writes instead
+func (f *Folder) Lock(timeout time.Duration) (func() error, error) {
+	locker, ok := f.store.(Locker)
+	if !ok {
+		return func() error { return nil }, nil
+	}
+
+	unlock, err := locker.Lock(timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.loadManifest(); err != nil {
+		unlock()
+		return nil, err
+	}
+	return unlock, nil
+}
+
+// Lock takes an advisory lock on the LOCK_FILE of the directory, which
+// holds the PID of the owner
+func (s *DirStore) Lock(timeout time.Duration) (func() error, error) {
+	if err := os.MkdirAll(s.Path, 0755); err != nil {
+		return nil, err
+	}
+	return lockFile(filepath.Join(s.Path, LOCK_FILE), timeout)
+}
+
+// lockedError reads the PID of the owner from the lock file
+func lockedError(path string) error {
+	content, _ := os.ReadFile(path)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrLocked, path)
+	}
+	return fmt.Errorf("%w by PID %d", ErrLocked, pid)
+}
@@ -0,0 +1,80 @@
+//go:build !unix || aix || solaris
+
+package manager
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lockFile creates path exclusively and writes the PID in it. A lock
+// left by a process that no longer exists is taken over
+func lockFile(path string, timeout time.Duration) (func() error, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			f.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+			f.Close()
+			return func() error { return os.Remove(path) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, err
+		}
+
+		if takeOverStaleLock(path) {
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, lockedError(path)
+		}
+		time.Sleep(LOCK_POLL_INTERVAL)
+	}
+}
+
+// takeOverStaleLock removes the lock if the process named in it is gone.
+// The lock is moved aside first, so that two processes recovering it at
+// once cannot delete the fresh lock of the other: only one rename
+// succeeds, and a lock renamed by mistake is put back
+func takeOverStaleLock(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	stale, err := f.Stat()
+	content, _ := io.ReadAll(f)
+	f.Close()
+	if err != nil || !isStalePID(string(content)) {
+		return false
+	}
+
+	aside := path + ".stale-" + strconv.Itoa(os.Getpid())
+	if err := os.Rename(path, aside); err != nil {
+		return false
+	}
+
+	// Another process replaced the stale lock between the check and the rename
+	if moved, err := os.Stat(aside); err != nil || !os.SameFile(stale, moved) {
+		if os.Link(aside, path) == nil {
+			os.Remove(aside)
+		}
+		return false
+	}
+
+	return os.Remove(aside) == nil
+}
+
+// isStalePID reports whether the process named in a lock file is gone
+func isStalePID(content string) bool {
+	pid, err := strconv.Atoi(strings.TrimSpace(content))
+	if err != nil {
+		return false
+	}
+	_, err = os.FindProcess(pid)
+	return err != nil
+}
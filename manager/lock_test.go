@@ -0,0 +1,107 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "manifest.json")
+	os.WriteFile(path, []byte("old content that is longer"), 0600)
+
+	if err := WriteFileAtomic(path, []byte("new"), 0644); err != nil {
+		t.Fatalf("WriteFileAtomic() = %v, want %v", err, nil)
+	}
+
+	content, _ := os.ReadFile(path)
+	if string(content) != "new" {
+		t.Errorf("WriteFileAtomic() content = %q, want %q", content, "new")
+	}
+	// The existing file keeps its mode, a new one gets perm
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("WriteFileAtomic() mode = %v, want %v", info.Mode().Perm(), os.FileMode(0600))
+	}
+	created := filepath.Join(dir, "created.json")
+	if err := WriteFileAtomic(created, []byte("new"), 0640); err != nil {
+		t.Fatalf("WriteFileAtomic() = %v, want %v", err, nil)
+	}
+	if info, _ := os.Stat(created); info.Mode().Perm() != 0640 {
+		t.Errorf("WriteFileAtomic() mode = %v, want %v", info.Mode().Perm(), os.FileMode(0640))
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("WriteFileAtomic() left %d files, want 2", len(entries))
+	}
+
+	// A failed write leaves no temporary file behind
+	if err := WriteFileAtomic(filepath.Join(dir, "missing", "file"), []byte("x"), 0644); err == nil {
+		t.Errorf("WriteFileAtomic() in a missing folder = %v, want an error", err)
+	}
+}
+
+func TestDirStoreLock(t *testing.T) {
+	store := NewDirStore(filepath.Join(t.TempDir(), DEFAULT_ENV_FOLDER))
+
+	unlock, err := store.Lock(time.Second)
+	if err != nil {
+		t.Fatalf("Lock() = %v, want %v", err, nil)
+	}
+
+	start := time.Now()
+	_, err = store.Lock(200 * time.Millisecond)
+	if !errors.Is(err, ErrLocked) || !strings.Contains(err.Error(), fmt.Sprintf("store is locked by PID %d", os.Getpid())) {
+		t.Errorf("Lock() while locked = %v, want %v by PID %d", err, ErrLocked, os.Getpid())
+	}
+	if waited := time.Since(start); waited < 200*time.Millisecond {
+		t.Errorf("Lock() returned after %v, want it to wait for the timeout", waited)
+	}
+
+	if err := unlock(); err != nil {
+		t.Fatalf("unlock() = %v, want %v", err, nil)
+	}
+
+	// Released locks can be taken again, waiting for the holder if needed
+	unlock, err = store.Lock(time.Second)
+	if err != nil {
+		t.Fatalf("Lock() after unlock = %v, want %v", err, nil)
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		unlock()
+	}()
+	unlock, err = store.Lock(5 * time.Second)
+	if err != nil {
+		t.Fatalf("Lock() waiting for the holder = %v, want %v", err, nil)
+	}
+	unlock()
+}
+
+func TestFolderLockReloadsManifest(t *testing.T) {
+	store := NewDirStore(t.TempDir())
+	first, _ := OpenFolder(store)
+	second, _ := OpenFolder(store)
+
+	saveTestEnvFile(t, second, "production", TEST_SECRET, "A=1\n")
+
+	unlock, err := first.Lock(time.Second)
+	if err != nil {
+		t.Fatalf("Lock() = %v, want %v", err, nil)
+	}
+	defer unlock()
+
+	if !first.hasIdentifier("production") {
+		t.Errorf("Lock() did not read the manifest written by another process")
+	}
+
+	// Stores without lock return a no-op
+	if unlock, err := newTestFolder(t).Lock(time.Second); err != nil || unlock() != nil {
+		t.Errorf("Lock() of a memory store = %v, want %v", err, nil)
+	}
+}
@@ -0,0 +1,27 @@
+package manager
+
+// Logger receives the progress messages of the package.
+// *log.Logger satisfies it
+type Logger interface {
+	Printf(format string, v ...any)
+}
+
+type discardLogger struct{}
+
+func (discardLogger) Printf(format string, v ...any) {}
+
+// Messages are discarded unless a logger is set
+var logger Logger = discardLogger{}
+
+// SetLogger sends the progress messages of the package to l.
+// A nil logger silences them again
+func SetLogger(l Logger) {
+	if l == nil {
+		l = discardLogger{}
+	}
+	logger = l
+}
+
+func logf(format string, args ...any) {
+	logger.Printf(format, args...)
+}
@@ -0,0 +1,116 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Per-project configuration, next to the .env-manager folder. It holds no
+// secrets and can be committed
+const PROJECT_CONFIG = ".env-manager.json"
+
+const STORE_DIR = "dir"
+const STORE_S3 = "s3"
+
+type ProjectConfig struct {
+	Store StoreConfig `json:"store"`
+}
+
+// StoreConfig selects where the encrypted files are kept. Credentials
+// for remote stores come from the environment
+type StoreConfig struct {
+	Type     string `json:"type"`
+	Path     string `json:"path,omitempty"` // dir
+	Endpoint string `json:"endpoint,omitempty"`
+	Region   string `json:"region,omitempty"`
+	Bucket   string `json:"bucket,omitempty"`
+	Prefix   string `json:"prefix,omitempty"`
+}
+
+// LoadProjectConfig reads the project configuration in dir. Without
+// configuration file the local .env-manager folder is used
+func LoadProjectConfig(dir string) (*ProjectConfig, error) {
+	c := &ProjectConfig{}
+
+	content, err := os.ReadFile(filepath.Join(dir, PROJECT_CONFIG))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(content, c); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", PROJECT_CONFIG, err)
+		}
+	}
+
+	if c.Store.Type == "" {
+		c.Store.Type = STORE_DIR
+	}
+	if c.Store.Type == STORE_DIR && c.Store.Path == "" {
+		c.Store.Path = DEFAULT_ENV_FOLDER
+	}
+
+	return c, nil
+}
+
+// IsRemote reports whether the files are kept outside the project
+func (c *ProjectConfig) IsRemote() bool {
+	return c.Store.Type != STORE_DIR
+}
+
+// OpenFolder opens the configured store. Relative paths are resolved
+// from dir, and a missing local folder is created
+func (c *ProjectConfig) OpenFolder(dir string) (*Folder, error) {
+	if c.Store.Type == STORE_DIR {
+		path := c.dirPath(dir)
+		return GetOrCreateFolder(&path)
+	}
+
+	store, err := c.OpenStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	return OpenFolder(store)
+}
+
+// OpenStore returns the configured store without creating anything.
+// Relative paths are resolved from dir
+func (c *ProjectConfig) OpenStore(dir string) (Store, error) {
+	switch c.Store.Type {
+	case STORE_DIR:
+		return NewDirStore(c.dirPath(dir)), nil
+	case STORE_S3:
+		store, err := NewS3Store(S3Config{
+			Endpoint: c.Store.Endpoint,
+			Region:   c.Store.Region,
+			Bucket:   c.Store.Bucket,
+			Prefix:   c.Store.Prefix,
+		})
+		if err != nil {
+			return nil, err
+		}
+		logf("Using store: %s\n", store)
+		return store, nil
+	}
+	return nil, fmt.Errorf("invalid %s: unknown store type %q, use %s or %s", PROJECT_CONFIG, c.Store.Type, STORE_DIR, STORE_S3)
+}
+
+func (c *ProjectConfig) dirPath(dir string) string {
+	if !filepath.IsAbs(c.Store.Path) && dir != "." {
+		return filepath.Join(dir, c.Store.Path)
+	}
+	return c.Store.Path
+}
+
+// OpenProjectFolder opens the store configured for the project in the
+// working directory, or the local folder if there is no configuration
+func OpenProjectFolder() (*Folder, error) {
+	c, err := LoadProjectConfig(".")
+	if err != nil {
+		return nil, err
+	}
+	return c.OpenFolder(".")
+}
@@ -0,0 +1,428 @@
+package manager
+
+import (
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// File in the env-manager folder listing who the configurations are encrypted for
+const RECIPIENTS_FILE = "recipients.json"
+
+// Encoding prefixes of X25519 keys
+const PUBLIC_KEY_PREFIX = "env-manager-pub-"
+const IDENTITY_PREFIX = "ENV-MANAGER-KEY-"
+
+// HKDF info used to derive the key wrapping key
+const WRAP_INFO = "env-manager x25519 data key"
+
+// Returned when the identity is not among the recipients of a file
+var ErrNotRecipient = fmt.Errorf("%w: identity is not a recipient of this file", ErrBadKey)
+
+// Identity is the X25519 private key of a team member
+type Identity struct {
+	key *ecdh.PrivateKey
+}
+
+// Recipient is a team member the configurations are encrypted for
+type Recipient struct {
+	Name      string `json:"name"`
+	PublicKey string `json:"public_key"`
+}
+
+// RecipientStanza holds the data key of a file wrapped for one recipient
+type RecipientStanza struct {
+	Name       string `json:"name"`
+	PublicKey  string `json:"public_key"`
+	Ephemeral  []byte `json:"ephemeral"`
+	WrappedKey []byte `json:"wrapped_key"`
+}
+
+type recipientsFile struct {
+	Recipients []*Recipient `json:"recipients"`
+}
+
+// GenerateIdentity creates a new random X25519 identity
+func GenerateIdentity() (*Identity, error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{key: key}, nil
+}
+
+// IsIdentity reports whether the secret is an X25519 identity rather
+// than a shared passphrase
+func IsIdentity(secret string) bool {
+	return strings.HasPrefix(strings.TrimSpace(secret), IDENTITY_PREFIX)
+}
+
+// ParseIdentity decodes an identity produced by Identity.String
+func ParseIdentity(s string) (*Identity, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, IDENTITY_PREFIX) {
+		return nil, errors.New("invalid identity: missing " + IDENTITY_PREFIX + " prefix")
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(s, IDENTITY_PREFIX))
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity: %w", err)
+	}
+
+	key, err := ecdh.X25519().NewPrivateKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity: %w", err)
+	}
+
+	return &Identity{key: key}, nil
+}
+
+func (i *Identity) String() string {
+	return IDENTITY_PREFIX + base64.RawURLEncoding.EncodeToString(i.key.Bytes())
+}
+
+// PublicKey returns the encoded public key to share with the team
+func (i *Identity) PublicKey() string {
+	return encodePublicKey(i.key.PublicKey())
+}
+
+func encodePublicKey(key *ecdh.PublicKey) string {
+	return PUBLIC_KEY_PREFIX + base64.RawURLEncoding.EncodeToString(key.Bytes())
+}
+
+// ParsePublicKey decodes a public key produced by Identity.PublicKey
+func ParsePublicKey(s string) (*ecdh.PublicKey, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, PUBLIC_KEY_PREFIX) {
+		return nil, errors.New("invalid public key: missing " + PUBLIC_KEY_PREFIX + " prefix")
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(s, PUBLIC_KEY_PREFIX))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+
+	key, err := ecdh.X25519().NewPublicKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+
+	return key, nil
+}
+
+// wrapKeyFor encrypts the data key for a recipient with an ephemeral
+// X25519 exchange, so only the recipient's identity can unwrap it
+func wrapKeyFor(dataKey []byte, r *Recipient) (*RecipientStanza, error) {
+	pub, err := ParsePublicKey(r.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", r.Name, err)
+	}
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	shared, err := ephemeral.ECDH(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	ephemeralPub := ephemeral.PublicKey().Bytes()
+	kek, err := hkdf.Key(sha256.New, shared, append(ephemeralPub, pub.Bytes()...), WRAP_INFO, KEY_SIZE)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, err := sealGCM(kek, dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RecipientStanza{
+		Name:       r.Name,
+		PublicKey:  encodePublicKey(pub),
+		Ephemeral:  ephemeralPub,
+		WrappedKey: wrapped,
+	}, nil
+}
+
+// unwrapKey finds the stanza for the identity and returns the data key
+func (i *Identity) unwrapKey(stanzas []*RecipientStanza) ([]byte, error) {
+	publicKey := i.PublicKey()
+
+	for _, s := range stanzas {
+		if s.PublicKey != publicKey {
+			continue
+		}
+
+		ephemeral, err := ecdh.X25519().NewPublicKey(s.Ephemeral)
+		if err != nil {
+			return nil, corruptFileError(err.Error())
+		}
+
+		shared, err := i.key.ECDH(ephemeral)
+		if err != nil {
+			return nil, corruptFileError(err.Error())
+		}
+
+		kek, err := hkdf.Key(sha256.New, shared, append(s.Ephemeral, i.key.PublicKey().Bytes()...), WRAP_INFO, KEY_SIZE)
+		if err != nil {
+			return nil, err
+		}
+
+		dataKey, err := openGCM(kek, s.WrappedKey)
+		if err != nil {
+			return nil, corruptFileError("wrapped key")
+		}
+		return dataKey, nil
+	}
+
+	return nil, fmt.Errorf("%w: %w", ErrDecryptionFailed, ErrNotRecipient)
+}
+
+// wrapForRecipients wraps the data key for every recipient
+func wrapForRecipients(dataKey []byte, recipients []*Recipient) ([]*RecipientStanza, error) {
+	var stanzas []*RecipientStanza
+	for _, r := range recipients {
+		s, err := wrapKeyFor(dataKey, r)
+		if err != nil {
+			return nil, err
+		}
+		stanzas = append(stanzas, s)
+	}
+	return stanzas, nil
+}
+
+// LoadRecipients reads the recipients of the folder. A folder without
+// recipients file uses the shared secret
+func (f *Folder) LoadRecipients() ([]*Recipient, error) {
+	content, err := f.store.ReadFile(RECIPIENTS_FILE)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && strings.TrimSpace(string(content)) == "") {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r := &recipientsFile{}
+	if err := json.Unmarshal(content, r); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", RECIPIENTS_FILE, err)
+	}
+
+	return r.Recipients, nil
+}
+
+func encodeRecipients(recipients []*Recipient) (string, error) {
+	b, err := json.MarshalIndent(&recipientsFile{Recipients: recipients}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b) + "\n", nil
+}
+
+// AddRecipient gives a new team member access to every configuration
+func (f *Folder) AddRecipient(secret string, name string, publicKey string) error {
+	if _, err := ParsePublicKey(publicKey); err != nil {
+		return err
+	}
+
+	recipients, err := f.LoadRecipients()
+	if err != nil {
+		return err
+	}
+
+	for _, r := range recipients {
+		if r.Name == name {
+			return fmt.Errorf("recipient %s already exists", name)
+		}
+	}
+
+	recipients = append(recipients, &Recipient{Name: name, PublicKey: strings.TrimSpace(publicKey)})
+	return f.Rewrap(secret, recipients)
+}
+
+// RemoveRecipient revokes the access of a team member. The removed member
+// may have kept the data keys, so every configuration and revision is
+// encrypted again under a new data key for the remaining recipients
+func (f *Folder) RemoveRecipient(secret string, name string) error {
+	recipients, err := f.LoadRecipients()
+	if err != nil {
+		return err
+	}
+
+	var remaining []*Recipient
+	for _, r := range recipients {
+		if r.Name != name {
+			remaining = append(remaining, r)
+		}
+	}
+
+	if len(remaining) == len(recipients) {
+		return fmt.Errorf("recipient %s not found", name)
+	}
+
+	if len(remaining) == 0 {
+		return errors.New("cannot remove the last recipient")
+	}
+
+	return f.replaceRecipients(remaining, func(e *EnvFile) error {
+		if err := e.decrypt(secret); err != nil {
+			return err
+		}
+		return e.encrypt(secret, remaining)
+	})
+}
+
+// Rewrap wraps the data key of every configuration and revision for the given
+// recipients and saves the recipients file.
+//
+// Files already encrypted for recipients keep their payload, only the
+// key stanzas change, so secret must be the identity of a current
+// recipient. Files still encrypted with the shared secret are decrypted
+// with it and encrypted again under a new data key.
+// Like RotateSecret, nothing in the store changes if any file fails.
+func (f *Folder) Rewrap(secret string, recipients []*Recipient) error {
+	return f.replaceRecipients(recipients, func(e *EnvFile) error {
+		return e.rewrap(secret, recipients)
+	})
+}
+
+// replaceRecipients re-encrypts every configuration and revision with
+// reencrypt and saves the recipients file, or changes nothing if any fails
+func (f *Folder) replaceRecipients(recipients []*Recipient, reencrypt func(e *EnvFile) error) error {
+	var files []*replacedFile
+
+	for _, id := range f.Identifiers() {
+		e, err := f.GetEnvFile(id)
+		if err != nil {
+			return err
+		}
+
+		previous := e.encrypted
+		if err := reencrypt(e); err != nil {
+			return fmt.Errorf("%s: %w", id, err)
+		}
+
+		files = append(files, &replacedFile{
+			name:       id,
+			identifier: id,
+			file:       storedName(id),
+			previous:   previous,
+			content:    e.encrypted,
+		})
+
+		history, err := f.replaceHistory(id, reencrypt)
+		if err != nil {
+			return err
+		}
+		if history != nil {
+			files = append(files, history)
+		}
+	}
+
+	encoded, err := encodeRecipients(recipients)
+	if err != nil {
+		return err
+	}
+
+	previous, _ := f.store.ReadFile(RECIPIENTS_FILE)
+	files = append(files, &replacedFile{
+		name:     RECIPIENTS_FILE,
+		file:     RECIPIENTS_FILE,
+		previous: string(previous),
+		content:  encoded,
+	})
+
+	if err := replaceFiles(f.store, files); err != nil {
+		return err
+	}
+	return f.recordReplaced(files)
+}
+
+// LoadRecipients reads the recipients of the local folder
+func LoadRecipients(folderPath string) ([]*Recipient, error) {
+	f, err := OpenFolder(NewDirStore(folderPath))
+	if err != nil {
+		return nil, err
+	}
+	return f.LoadRecipients()
+}
+
+func AddRecipient(folder *string, secret string, name string, publicKey string) error {
+	f, err := GetOrCreateFolder(folder)
+	if err != nil {
+		return err
+	}
+	return f.AddRecipient(secret, name, publicKey)
+}
+
+func RemoveRecipient(folder *string, secret string, name string) error {
+	f, err := GetOrCreateFolder(folder)
+	if err != nil {
+		return err
+	}
+	return f.RemoveRecipient(secret, name)
+}
+
+func RewrapFolder(folder *string, secret string, recipients []*Recipient) error {
+	f, err := GetOrCreateFolder(folder)
+	if err != nil {
+		return err
+	}
+	return f.Rewrap(secret, recipients)
+}
+
+// rewrap re-encrypts the data key of the file for the recipients
+func (e *EnvFile) rewrap(secret string, recipients []*Recipient) error {
+	if e.envelope == nil {
+		env, err := DecodeEnvelope(e.encrypted)
+		if err != nil {
+			return err
+		}
+		e.envelope = env
+	}
+
+	// Shared secret files have no data key to wrap
+	if len(e.envelope.Recipients) == 0 {
+		if err := e.decrypt(secret); err != nil {
+			return err
+		}
+		return e.encrypt(secret, recipients)
+	}
+
+	identity, err := ParseIdentity(secret)
+	if err != nil {
+		return badKeyError(err.Error())
+	}
+
+	dataKey, err := identity.unwrapKey(e.envelope.Recipients)
+	if err != nil {
+		return err
+	}
+
+	stanzas, err := wrapForRecipients(dataKey, recipients)
+	if err != nil {
+		return err
+	}
+
+	e.envelope.Version = FORMAT_VERSION
+	e.envelope.Recipients = stanzas
+	e.envelope.UpdatedAt = time.Now().UTC()
+
+	encoded, err := e.envelope.Encode()
+	if err != nil {
+		return err
+	}
+	e.encrypted = encoded
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package manager
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestIdentityRoundTrip(t *testing.T) {
+	identity, err := GenerateIdentity()
+	if err != nil {
+		t.Fatalf("GenerateIdentity() = %v, want %v", err, nil)
+	}
+
+	parsed, err := ParseIdentity(identity.String())
+	if err != nil {
+		t.Fatalf("ParseIdentity() = %v, want %v", err, nil)
+	}
+
+	if parsed.PublicKey() != identity.PublicKey() {
+		t.Errorf("ParseIdentity() public key = %v, want %v", parsed.PublicKey(), identity.PublicKey())
+	}
+
+	if !IsIdentity(identity.String()) || IsIdentity(TEST_SECRET) {
+		t.Errorf("IsIdentity() does not tell identities and passphrases apart")
+	}
+
+	if _, err := ParsePublicKey(identity.String()); err == nil {
+		t.Errorf("ParsePublicKey() accepted an identity")
+	}
+}
+
+func decryptStored(t *testing.T, f *Folder, identifier string, secret string) (*EnvFile, error) {
+	t.Helper()
+	e, err := f.GetEnvFile(identifier)
+	if err != nil {
+		t.Fatalf("GetEnvFile() = %v, want %v", err, nil)
+	}
+	return e, e.decrypt(secret)
+}
+
+func TestRecipients(t *testing.T) {
+	alice, _ := GenerateIdentity()
+	bob, _ := GenerateIdentity()
+
+	f := newTestFolder(t)
+	saveTestEnvFile(t, f, "production", TEST_SECRET, "HELLO=WORLD\n")
+
+	// The first recipient is added with the shared secret
+	if err := f.AddRecipient(TEST_SECRET, "alice", alice.PublicKey()); err != nil {
+		t.Fatalf("AddRecipient(alice) = %v, want %v", err, nil)
+	}
+
+	e, err := decryptStored(t, f, "production", alice.String())
+	if err != nil {
+		t.Fatalf("decrypt() as alice = %v, want %v", err, nil)
+	}
+	want := e.fileContent
+	ciphertext := e.envelope.Ciphertext
+
+	if _, err := decryptStored(t, f, "production", TEST_SECRET); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("decrypt() with shared secret = %v, want %v", err, ErrDecryptionFailed)
+	}
+
+	// Alice adds bob, the payload is not encrypted again
+	if err := f.AddRecipient(alice.String(), "bob", bob.PublicKey()); err != nil {
+		t.Fatalf("AddRecipient(bob) = %v, want %v", err, nil)
+	}
+
+	e, err = decryptStored(t, f, "production", bob.String())
+	if err != nil {
+		t.Fatalf("decrypt() as bob = %v, want %v", err, nil)
+	}
+
+	if e.fileContent != want {
+		t.Errorf("decrypt() as bob = %v, want %v", e.fileContent, want)
+	}
+
+	if !bytes.Equal(e.envelope.Ciphertext, ciphertext) {
+		t.Errorf("AddRecipient() re-encrypted the payload")
+	}
+
+	// New files are encrypted for both
+	saveTestEnvFile(t, f, "staging", alice.String(), "HELLO=STAGING\n")
+	if _, err := decryptStored(t, f, "staging", bob.String()); err != nil {
+		t.Errorf("decrypt() new file as bob = %v, want %v", err, nil)
+	}
+
+	// Bob may have kept the data key of a file they could read
+	e, _ = decryptStored(t, f, "production", bob.String())
+	bobKey, err := bob.unwrapKey(e.envelope.Recipients)
+	if err != nil {
+		t.Fatalf("unwrapKey() as bob = %v, want %v", err, nil)
+	}
+
+	if err := f.RemoveRecipient(alice.String(), "bob"); err != nil {
+		t.Fatalf("RemoveRecipient(bob) = %v, want %v", err, nil)
+	}
+
+	for _, id := range []string{"production", "staging"} {
+		if _, err := decryptStored(t, f, id, bob.String()); !errors.Is(err, ErrNotRecipient) {
+			t.Errorf("decrypt(%s) as removed bob = %v, want %v", id, err, ErrNotRecipient)
+		}
+		if _, err := decryptStored(t, f, id, alice.String()); err != nil {
+			t.Errorf("decrypt(%s) as alice = %v, want %v", id, err, nil)
+		}
+	}
+
+	e, _ = decryptStored(t, f, "production", alice.String())
+	if _, err := openGCM(bobKey, e.envelope.Ciphertext); err == nil {
+		t.Errorf("RemoveRecipient() kept the data key known to bob")
+	}
+
+	if err := f.RemoveRecipient(alice.String(), "alice"); err == nil {
+		t.Errorf("RemoveRecipient() removed the last recipient")
+	}
+
+	if err := f.RotateSecret(alice.String(), ROTATED_SECRET); !errors.Is(err, ErrRecipientsConfigured) {
+		t.Errorf("RotateSecret() = %v, want %v", err, ErrRecipientsConfigured)
+	}
+}
@@ -0,0 +1,219 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Backups of a restore target are named <target>.backup-<time>[-<n>]
+const RESTORE_BACKUP_INFIX = ".backup-"
+const RESTORE_BACKUP_TIME = "20060102-150405"
+
+// Mode of a restore target created by a restore. Existing targets keep
+// their mode
+const RESTORE_FILE_MODE = 0600
+
+// Comment written above the local variables kept by a merge
+const MERGE_COMMENT = "# Kept from the local file by env-manager get --merge"
+
+// Returned when the restore target has content the configuration does not
+var ErrTargetModified = errors.New("restore target has local changes")
+
+// RestoreConflict describes how an existing restore target differs from
+// the stored configuration. Changes go from the stored variables to the
+// local ones and are empty when only comments or formatting differ
+type RestoreConflict struct {
+	Path    string
+	Changes []VariableChange
+}
+
+func (e *RestoreConflict) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, ErrTargetModified)
+}
+
+func (e *RestoreConflict) Unwrap() error {
+	return ErrTargetModified
+}
+
+// RestoreOptions say what to do with a restore target that differs from
+// the configuration. Without any, RestoreEnvFileWith refuses to write
+type RestoreOptions struct {
+	Force  bool // Overwrite the target
+	Backup bool // Copy the target to a timestamped file, then overwrite it
+	Merge  bool // Keep the variables only the target has
+}
+
+// RestoreResult tells what a restore did
+type RestoreResult struct {
+	Path      string
+	Unchanged bool     // The target already had the content
+	Backup    string   // Copy of the previous target, if one was made
+	Kept      []string // Variables of the target kept by a merge
+}
+
+// BackupPattern is the .gitignore pattern matching the backups of target
+func BackupPattern(target string) string {
+	return target + RESTORE_BACKUP_INFIX + "*"
+}
+
+/// Functions
+
+// RestoreEnvFile decrypts the environment file and writes it to its
+// restore-as path. Nothing is written if decryption fails or if the
+// target exists with other content
+func RestoreEnvFile(e *EnvFile, decryptSecret string) error {
+	_, err := RestoreEnvFileWith(e, decryptSecret, RestoreOptions{})
+	return err
+}
+
+// RestoreEnvFileWith restores like RestoreEnvFile, resolving a modified
+// target as the options say. A refused restore returns a *RestoreConflict
+func RestoreEnvFileWith(e *EnvFile, decryptSecret string, opts RestoreOptions) (*RestoreResult, error) {
+	if err := DecryptEnvFile(e, decryptSecret); err != nil {
+		return nil, err
+	}
+
+	path := e.header.RestoreAs
+	result := &RestoreResult{Path: path}
+	content := e.fileContent
+
+	local, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		local = nil
+	case err != nil:
+		return nil, err
+	case string(local) == content:
+		result.Unchanged = true
+		return result, nil
+	default:
+		if !opts.Force && !opts.Backup && !opts.Merge {
+			return nil, restoreConflict(path, content, string(local))
+		}
+	}
+
+	if local != nil && opts.Merge {
+		content, result.Kept, err = mergeLocal(content, string(local))
+		if err != nil {
+			return nil, fmt.Errorf("merging %s: %w", path, err)
+		}
+	}
+
+	if local != nil && opts.Backup {
+		if result.Backup, err = writeBackup(path, local); err != nil {
+			return nil, fmt.Errorf("writing backup of %s: %w", path, err)
+		}
+	}
+
+	logf("Restoring %s as %s\n", e.header.Identifier, path)
+
+	if err := WriteFileAtomic(path, []byte(content), RESTORE_FILE_MODE); err != nil {
+		return nil, fmt.Errorf("writing %s: %w", path, err)
+	}
+
+	return result, nil
+}
+
+// writeBackup copies data to a new <path>.backup-<time> file. The file is
+// created exclusively, with a counter added when a backup was already
+// made in the same second
+func writeBackup(path string, data []byte) (string, error) {
+	base := path + RESTORE_BACKUP_INFIX + time.Now().Format(RESTORE_BACKUP_TIME)
+	for i := 1; ; i++ {
+		name := base
+		if i > 1 {
+			name = fmt.Sprintf("%s-%d", base, i)
+		}
+
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		_, err = f.Write(data)
+		if err == nil {
+			err = f.Sync()
+		}
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(name)
+			return "", err
+		}
+		return name, nil
+	}
+}
+
+// restoreConflict compares the variables of the stored and local content.
+// A local file that is not a dotenv file only reports the conflict
+func restoreConflict(path string, stored string, local string) error {
+	conflict := &RestoreConflict{Path: path}
+
+	storedVars, err := ParseDotenv(stored)
+	if err != nil {
+		return conflict
+	}
+	localVars, err := ParseDotenv(local)
+	if err != nil {
+		return conflict
+	}
+
+	conflict.Changes = DiffVariables(storedVars, localVars)
+	return conflict
+}
+
+// mergeLocal appends the variables only the local content has to the
+// stored content and returns their names. Variables both have keep the
+// stored value
+func mergeLocal(stored string, local string) (string, []string, error) {
+	storedVars, err := ParseDotenv(stored)
+	if err != nil {
+		return "", nil, err
+	}
+	localVars, err := ParseDotenv(local)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var kept []string
+	var b strings.Builder
+	for _, e := range localVars.entries {
+		if e.Key == "" {
+			continue
+		}
+		if _, ok := storedVars.Get(e.Key); ok {
+			continue
+		}
+		if b.Len() == 0 {
+			b.WriteString("\n" + MERGE_COMMENT + "\n")
+		}
+		// Every declaration is kept, so the last one still wins
+		if !slices.Contains(kept, e.Key) {
+			kept = append(kept, e.Key)
+		}
+		b.WriteString(strings.TrimSuffix(e.raw, "\n") + "\n")
+	}
+
+	if len(kept) == 0 {
+		return stored, nil, nil
+	}
+	if stored != "" && !strings.HasSuffix(stored, "\n") {
+		stored += "\n"
+	}
+	return stored + b.String(), kept, nil
+}
+
+// isBackupOf reports whether name is a backup of a file named target
+func isBackupOf(name string, target string) bool {
+	return strings.HasPrefix(name, filepath.Base(target)+RESTORE_BACKUP_INFIX)
+}
@@ -0,0 +1,141 @@
+package manager
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRestoreEnvFileWith(t *testing.T) {
+	t.Chdir(t.TempDir())
+	f := newTestFolder(t)
+	saveTestEnvFile(t, f, "production", TEST_SECRET, "API_KEY=stored\nPORT=80\n")
+	stored := getEnvFileContent("production", "API_KEY=stored", "PORT=80")
+
+	restore := func(opts RestoreOptions) (*RestoreResult, error) {
+		e, err := f.GetEnvFile("production")
+		if err != nil {
+			t.Fatalf("GetEnvFile() = %v, want %v", err, nil)
+		}
+		return RestoreEnvFileWith(e, TEST_SECRET, opts)
+	}
+
+	if result, err := restore(RestoreOptions{}); err != nil || result.Unchanged {
+		t.Fatalf("RestoreEnvFileWith() = %+v, %v, want a restore", result, err)
+	}
+	if result, err := restore(RestoreOptions{}); err != nil || !result.Unchanged {
+		t.Errorf("RestoreEnvFileWith() again = %+v, %v, want unchanged", result, err)
+	}
+
+	local := "API_KEY=local\nLOCAL=1\n"
+	os.WriteFile(DEFAULT_RESTORE_AS, []byte(local), 0644)
+
+	_, err := restore(RestoreOptions{})
+	var conflict *RestoreConflict
+	if !errors.As(err, &conflict) || !errors.Is(err, ErrTargetModified) {
+		t.Fatalf("RestoreEnvFileWith() = %v, want %v", err, ErrTargetModified)
+	}
+	var changes []string
+	for _, c := range conflict.Changes {
+		changes = append(changes, c.String(false))
+	}
+	if got, want := strings.Join(changes, ","), "~ API_KEY: ******** -> ********,- PORT=********,+ LOCAL=********"; got != want {
+		t.Errorf("RestoreConflict.Changes = %s, want %s", got, want)
+	}
+	if content, _ := os.ReadFile(DEFAULT_RESTORE_AS); string(content) != local {
+		t.Errorf("RestoreEnvFileWith() wrote %q over local changes", content)
+	}
+
+	result, err := restore(RestoreOptions{Backup: true, Merge: true})
+	if err != nil {
+		t.Fatalf("RestoreEnvFileWith() = %v, want %v", err, nil)
+	}
+	if backup, _ := os.ReadFile(result.Backup); string(backup) != local {
+		t.Errorf("RestoreEnvFileWith() backup = %q, want %q", backup, local)
+	}
+	if matched, _ := filepath.Match(BackupPattern(DEFAULT_RESTORE_AS), result.Backup); !matched {
+		t.Errorf("RestoreEnvFileWith() backup = %s, want it to match %s", result.Backup, BackupPattern(DEFAULT_RESTORE_AS))
+	}
+	want := stored + "\n" + MERGE_COMMENT + "\nLOCAL=1\n"
+	if content, _ := os.ReadFile(DEFAULT_RESTORE_AS); string(content) != want {
+		t.Errorf("RestoreEnvFileWith() merged = %q, want %q", content, want)
+	}
+	if strings.Join(result.Kept, ",") != "LOCAL" {
+		t.Errorf("RestoreEnvFileWith() kept = %v, want %v", result.Kept, []string{"LOCAL"})
+	}
+
+	os.WriteFile(DEFAULT_RESTORE_AS, []byte("not a dotenv file\n"), 0644)
+	if _, err := restore(RestoreOptions{}); !errors.As(err, &conflict) || conflict.Changes != nil {
+		t.Errorf("RestoreEnvFileWith() over another file = %v, want a conflict without changes", err)
+	}
+	if _, err := restore(RestoreOptions{Force: true}); err != nil {
+		t.Fatalf("RestoreEnvFileWith() with Force = %v, want %v", err, nil)
+	}
+	if content, _ := os.ReadFile(DEFAULT_RESTORE_AS); string(content) != stored {
+		t.Errorf("RestoreEnvFileWith() with Force = %q, want %q", content, stored)
+	}
+}
+
+func TestWriteBackup(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	// Backups made within the same second do not replace each other
+	first, err := writeBackup(DEFAULT_RESTORE_AS, []byte("A=1\n"))
+	if err != nil {
+		t.Fatalf("writeBackup() = %v, want %v", err, nil)
+	}
+	second, err := writeBackup(DEFAULT_RESTORE_AS, []byte("A=2\n"))
+	if err != nil {
+		t.Fatalf("writeBackup() = %v, want %v", err, nil)
+	}
+	if first == second {
+		t.Fatalf("writeBackup() = %s twice, want two names", first)
+	}
+
+	for name, want := range map[string]string{first: "A=1\n", second: "A=2\n"} {
+		if content, _ := os.ReadFile(name); string(content) != want {
+			t.Errorf("writeBackup() %s = %q, want %q", name, content, want)
+		}
+		if matched, _ := filepath.Match(BackupPattern(DEFAULT_RESTORE_AS), name); !matched {
+			t.Errorf("writeBackup() = %s, want it to match %s", name, BackupPattern(DEFAULT_RESTORE_AS))
+		}
+	}
+}
+
+func TestRestoreEnvFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not enforced on windows")
+	}
+	t.Chdir(t.TempDir())
+	f := newTestFolder(t)
+	saveTestEnvFile(t, f, "production", TEST_SECRET, "API_KEY=stored\n")
+
+	restore := func(opts RestoreOptions) {
+		t.Helper()
+		e, _ := f.GetEnvFile("production")
+		if _, err := RestoreEnvFileWith(e, TEST_SECRET, opts); err != nil {
+			t.Fatalf("RestoreEnvFileWith() = %v, want %v", err, nil)
+		}
+	}
+	mode := func() os.FileMode {
+		info, _ := os.Stat(DEFAULT_RESTORE_AS)
+		return info.Mode().Perm()
+	}
+
+	// A new target is private
+	restore(RestoreOptions{})
+	if got := mode(); got != RESTORE_FILE_MODE {
+		t.Errorf("RestoreEnvFileWith() mode = %v, want %v", got, os.FileMode(RESTORE_FILE_MODE))
+	}
+
+	// An existing target keeps its mode
+	os.WriteFile(DEFAULT_RESTORE_AS, []byte("API_KEY=local\n"), 0640)
+	os.Chmod(DEFAULT_RESTORE_AS, 0640)
+	restore(RestoreOptions{Force: true})
+	if got := mode(); got != 0640 {
+		t.Errorf("RestoreEnvFileWith() mode = %v, want %v", got, os.FileMode(0640))
+	}
+}
@@ -0,0 +1,141 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Suffix of the staging files written while replacing files in the folder
+const ROTATE_SUFFIX = ".rotate"
+
+// Returned when rotating the secret of a folder whose files are encrypted
+// for recipients instead of the shared secret
+var ErrRecipientsConfigured = errors.New("folder is encrypted for recipients, use `recipients remove` to revoke access")
+
+type replacedFile struct {
+	name       string // Shown in errors
+	identifier string // Configuration stored in the file, empty for other files
+	file       string // Name in the store
+	previous   string // Content before the replacement, empty if the file is new
+	content    string // Content after the replacement
+}
+
+// RotateSecret re-encrypts every configuration in the folder and its
+// history with newSecret.
+//
+// All configurations are decrypted and re-encrypted in memory first, then
+// staged next to the originals and renamed into place. If any configuration
+// fails to decrypt or any write fails, the folder is left as it was.
+func (f *Folder) RotateSecret(oldSecret string, newSecret string) error {
+	if newSecret == "" {
+		return fmt.Errorf("new secret is empty")
+	}
+
+	if newSecret == oldSecret {
+		return fmt.Errorf("new secret is the same as the current one")
+	}
+
+	recipients, err := f.LoadRecipients()
+	if err != nil {
+		return err
+	}
+	if len(recipients) > 0 {
+		return ErrRecipientsConfigured
+	}
+
+	var files []*replacedFile
+
+	for _, id := range f.Identifiers() {
+		e, err := f.GetEnvFile(id)
+		if err != nil {
+			return err
+		}
+
+		previous := e.encrypted
+		if err := e.decrypt(oldSecret); err != nil {
+			return fmt.Errorf("%s: %w", id, err)
+		}
+		if err := e.encrypt(newSecret, nil); err != nil {
+			return fmt.Errorf("%s: %w", id, err)
+		}
+
+		files = append(files, &replacedFile{
+			name:       id,
+			identifier: id,
+			file:       storedName(id),
+			previous:   previous,
+			content:    e.encrypted,
+		})
+
+		history, err := f.replaceHistory(id, func(r *EnvFile) error {
+			if err := r.decrypt(oldSecret); err != nil {
+				return err
+			}
+			return r.encrypt(newSecret, nil)
+		})
+		if err != nil {
+			return err
+		}
+		if history != nil {
+			files = append(files, history)
+		}
+	}
+
+	if err := replaceFiles(f.store, files); err != nil {
+		return err
+	}
+	return f.recordReplaced(files)
+}
+
+func RotateSecret(folder *string, oldSecret string, newSecret string) error {
+	f, err := GetOrCreateFolder(folder)
+	if err != nil {
+		return err
+	}
+	return f.RotateSecret(oldSecret, newSecret)
+}
+
+// replaceFiles writes every file to a staging name and renames them into
+// place. If a write or rename fails, the files already replaced get their
+// previous content back.
+func replaceFiles(store Store, files []*replacedFile) error {
+	// Stage every file before touching the originals
+	for i, r := range files {
+		if err := store.WriteFile(r.file+ROTATE_SUFFIX, []byte(r.content)); err != nil {
+			removeStaged(store, files[:i+1])
+			return fmt.Errorf("%s: %w", r.name, err)
+		}
+	}
+
+	for i, r := range files {
+		if err := store.Rename(r.file+ROTATE_SUFFIX, r.file); err != nil {
+			removeStaged(store, files[i:])
+			restoreReplaced(store, files[:i])
+			return fmt.Errorf("%s: %w", r.name, err)
+		}
+	}
+
+	return nil
+}
+
+func removeStaged(store Store, files []*replacedFile) {
+	for _, r := range files {
+		store.Remove(r.file + ROTATE_SUFFIX)
+	}
+}
+
+// restoreReplaced puts back the previous content of files that were
+// already renamed when a later rename failed
+func restoreReplaced(store Store, files []*replacedFile) {
+	for _, r := range files {
+		var err error
+		if r.previous == "" {
+			err = store.Remove(r.file)
+		} else {
+			err = store.WriteFile(r.file, []byte(r.previous))
+		}
+		if err != nil {
+			logf("Error restoring %s: %v\n", r.file, err)
+		}
+	}
+}
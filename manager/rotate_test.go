@@ -0,0 +1,124 @@
+package manager
+
+import (
+	"errors"
+	"testing"
+)
+
+const ROTATED_SECRET = "a brand new passphrase"
+
+func saveTestEnvFile(t *testing.T, f *Folder, identifier string, secret string, content string) {
+	t.Helper()
+	e := InitEnvFile(identifier, DEFAULT_RESTORE_AS)
+	e.SetContent(content)
+	if err := f.AddFileIdentifier(EnvFilePath(identifier), EnvFileIdentifier(identifier)); err != nil {
+		t.Fatalf("AddFileIdentifier() = %v, want %v", err, nil)
+	}
+	if err := f.SaveEnvFile(e, secret); err != nil {
+		t.Fatalf("SaveEnvFile() = %v, want %v", err, nil)
+	}
+}
+
+func TestRotateSecret(t *testing.T) {
+	f := newTestFolder(t)
+	saveTestEnvFile(t, f, "staging", TEST_SECRET, "HELLO=STAGING\n")
+	saveTestEnvFile(t, f, "production", TEST_SECRET, "HELLO=PRODUCTION\n")
+
+	if err := f.RotateSecret(TEST_SECRET, ROTATED_SECRET); err != nil {
+		t.Fatalf("RotateSecret() = %v, want %v", err, nil)
+	}
+
+	for _, id := range []string{"staging", "production"} {
+		e, err := f.GetEnvFile(id)
+		if err != nil {
+			t.Fatalf("GetEnvFile() = %v, want %v", err, nil)
+		}
+
+		if err := e.decrypt(ROTATED_SECRET); err != nil {
+			t.Errorf("decrypt(%s) with new secret = %v, want %v", id, err, nil)
+		}
+
+		e, _ = f.GetEnvFile(id)
+		if err := e.decrypt(TEST_SECRET); !errors.Is(err, ErrDecryptionFailed) {
+			t.Errorf("decrypt(%s) with old secret = %v, want %v", id, err, ErrDecryptionFailed)
+		}
+	}
+}
+
+func TestRotateSecretIsAllOrNothing(t *testing.T) {
+	f := newTestFolder(t)
+	saveTestEnvFile(t, f, "staging", TEST_SECRET, "HELLO=STAGING\n")
+	// Encrypted with a different secret, so the rotation must fail
+	saveTestEnvFile(t, f, "production", "some other secret", "HELLO=PRODUCTION\n")
+
+	before := make(map[string]string)
+	for _, id := range []string{"staging", "production"} {
+		content, _ := f.Store().ReadFile(storedName(id))
+		before[id] = string(content)
+	}
+
+	if err := f.RotateSecret(TEST_SECRET, ROTATED_SECRET); !errors.Is(err, ErrDecryptionFailed) {
+		t.Fatalf("RotateSecret() = %v, want %v", err, ErrDecryptionFailed)
+	}
+
+	names, _ := f.Store().List()
+	if len(names) != 5 {
+		t.Errorf("RotateSecret() left %v in the folder, want 5 files", names)
+	}
+
+	for id, want := range before {
+		content, _ := f.Store().ReadFile(storedName(id))
+		if string(content) != want {
+			t.Errorf("RotateSecret() changed %s after a failure", id)
+		}
+	}
+}
+
+// failingStore fails to rename the file named failOn
+type failingStore struct {
+	*MemoryStore
+	failOn string
+}
+
+func (s *failingStore) Rename(oldName string, newName string) error {
+	if newName == s.failOn {
+		return errors.New("disk full")
+	}
+	return s.MemoryStore.Rename(oldName, newName)
+}
+
+func TestRotateSecretRestoresOnRenameFailure(t *testing.T) {
+	store := &failingStore{MemoryStore: NewMemoryStore()}
+	f, err := OpenFolder(store)
+	if err != nil {
+		t.Fatalf("OpenFolder() = %v, want %v", err, nil)
+	}
+	saveTestEnvFile(t, f, "a", TEST_SECRET, "HELLO=A\n")
+	saveTestEnvFile(t, f, "b", TEST_SECRET, "HELLO=B\n")
+
+	before := make(map[string]string)
+	for _, id := range []string{"a", "b"} {
+		content, _ := store.ReadFile(storedName(id))
+		before[id] = string(content)
+	}
+
+	// Whichever file is renamed second fails, the first must be restored
+	ids := f.Identifiers()
+	store.failOn = storedName(ids[len(ids)-1])
+
+	if err := f.RotateSecret(TEST_SECRET, ROTATED_SECRET); err == nil {
+		t.Fatalf("RotateSecret() = %v, want an error", err)
+	}
+
+	for id, want := range before {
+		content, _ := store.ReadFile(storedName(id))
+		if string(content) != want {
+			t.Errorf("RotateSecret() changed %s after a failure", id)
+		}
+	}
+
+	names, _ := store.List()
+	if len(names) != 5 {
+		t.Errorf("RotateSecret() left %v in the folder, want 5 files", names)
+	}
+}
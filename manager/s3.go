@@ -0,0 +1,328 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Environment variables holding the credentials of the S3 store
+const ENV_AWS_ACCESS_KEY_ID = "AWS_ACCESS_KEY_ID"
+const ENV_AWS_SECRET_ACCESS_KEY = "AWS_SECRET_ACCESS_KEY"
+const ENV_AWS_SESSION_TOKEN = "AWS_SESSION_TOKEN"
+const ENV_AWS_REGION = "AWS_REGION"
+
+const DEFAULT_S3_ENDPOINT = "https://s3.amazonaws.com"
+const DEFAULT_S3_REGION = "us-east-1"
+
+// How long a request to the S3 server may take, so that a stalled
+// endpoint fails the command instead of hanging it
+const S3_REQUEST_TIMEOUT = 30 * time.Second
+
+// S3Config locates the bucket of an S3Store. Credentials are read from
+// the AWS_* environment variables when not set
+type S3Config struct {
+	Endpoint        string // Defaults to AWS, set it for MinIO and other servers
+	Region          string
+	Bucket          string
+	Prefix          string // Folder inside the bucket
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// S3Store keeps the files in a bucket of an S3 compatible server.
+//
+// Writes are conditional: a file that was read is only overwritten if its
+// ETag did not change meanwhile, and a file that was missing is only
+// created if nobody created it first. Otherwise ErrConflict is returned.
+type S3Store struct {
+	config S3Config
+	creds  awsCredentials
+	client *http.Client
+	now    func() time.Time
+
+	mu    sync.Mutex
+	etags map[string]string // Last ETag seen per name, "" when missing
+}
+
+func NewS3Store(config S3Config) (*S3Store, error) {
+	if config.Bucket == "" {
+		return nil, errors.New("s3 store: bucket is required")
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = DEFAULT_S3_ENDPOINT
+	}
+	if config.Region == "" {
+		config.Region = os.Getenv(ENV_AWS_REGION)
+	}
+	if config.Region == "" {
+		config.Region = DEFAULT_S3_REGION
+	}
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+	config.Prefix = strings.Trim(config.Prefix, "/")
+
+	creds := awsCredentials{
+		AccessKeyID:     config.AccessKeyID,
+		SecretAccessKey: config.SecretAccessKey,
+		SessionToken:    config.SessionToken,
+	}
+	if creds.AccessKeyID == "" {
+		creds.AccessKeyID = os.Getenv(ENV_AWS_ACCESS_KEY_ID)
+		creds.SecretAccessKey = os.Getenv(ENV_AWS_SECRET_ACCESS_KEY)
+		creds.SessionToken = os.Getenv(ENV_AWS_SESSION_TOKEN)
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, fmt.Errorf("s3 store: set %s and %s", ENV_AWS_ACCESS_KEY_ID, ENV_AWS_SECRET_ACCESS_KEY)
+	}
+
+	if _, err := url.Parse(config.Endpoint); err != nil {
+		return nil, fmt.Errorf("s3 store: invalid endpoint: %w", err)
+	}
+
+	return &S3Store{
+		config: config,
+		creds:  creds,
+		client: &http.Client{Timeout: S3_REQUEST_TIMEOUT},
+		now:    time.Now,
+		etags:  make(map[string]string),
+	}, nil
+}
+
+func (s *S3Store) String() string {
+	if s.config.Prefix == "" {
+		return fmt.Sprintf("s3://%s", s.config.Bucket)
+	}
+	return fmt.Sprintf("s3://%s/%s", s.config.Bucket, s.config.Prefix)
+}
+
+func (s *S3Store) key(name string) (string, error) {
+	if !fs.ValidPath(name) || name == "." {
+		return "", fmt.Errorf("invalid file name %q", name)
+	}
+	if s.config.Prefix == "" {
+		return name, nil
+	}
+	return s.config.Prefix + "/" + name, nil
+}
+
+// request sends a signed path-style request for key, or for the bucket
+// when key is empty
+func (s *S3Store) request(method string, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u, err := url.Parse(s.config.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = "/" + s.config.Bucket
+	u.RawPath = "/" + uriEncode(s.config.Bucket, true)
+	if key != "" {
+		u.Path += "/" + key
+		u.RawPath += "/" + uriEncode(key, false)
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	signV4(req, s.creds, s.config.Region, "s3", sha256Hex(body), s.now())
+	return s.client.Do(req)
+}
+
+// s3Error is the error document returned by S3
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func responseError(resp *http.Response, name string) error {
+	body, _ := io.ReadAll(resp.Body)
+	e := &s3Error{}
+	if xml.Unmarshal(body, e) != nil || e.Code == "" {
+		e.Code = resp.Status
+	}
+
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return &fs.PathError{Op: "s3", Path: name, Err: fs.ErrNotExist}
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		return fmt.Errorf("%w: %s", ErrConflict, name)
+	}
+
+	if e.Message != "" {
+		return fmt.Errorf("s3 %s: %s: %s", name, e.Code, e.Message)
+	}
+	return fmt.Errorf("s3 %s: %s", name, e.Code)
+}
+
+func (s *S3Store) setETag(name string, etag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.etags[name] = etag
+}
+
+func (s *S3Store) ReadFile(name string) ([]byte, error) {
+	key, err := s.key(name)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.request(http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		s.setETag(name, "")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp, name)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	s.setETag(name, resp.Header.Get("ETag"))
+	return data, nil
+}
+
+func (s *S3Store) WriteFile(name string, data []byte) error {
+	key, err := s.key(name)
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	s.mu.Lock()
+	etag, seen := s.etags[name]
+	s.mu.Unlock()
+	if seen && etag == "" {
+		header.Set("If-None-Match", "*")
+	} else if seen {
+		header.Set("If-Match", etag)
+	}
+
+	resp, err := s.request(http.MethodPut, key, nil, header, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp, name)
+	}
+	s.setETag(name, resp.Header.Get("ETag"))
+	return nil
+}
+
+// Remove deletes the file. S3 does not report missing files on delete,
+// so their existence is checked first
+func (s *S3Store) Remove(name string) error {
+	key, err := s.key(name)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.request(http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp, name)
+	}
+
+	resp, err = s.request(http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return responseError(resp, name)
+	}
+	s.setETag(name, "")
+	return nil
+}
+
+// Rename copies the file and deletes the original. S3 has no rename
+func (s *S3Store) Rename(oldName string, newName string) error {
+	data, err := s.ReadFile(oldName)
+	if err != nil {
+		return err
+	}
+	if err := s.WriteFile(newName, data); err != nil {
+		return err
+	}
+	return s.Remove(oldName)
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *S3Store) List() ([]string, error) {
+	prefix := ""
+	if s.config.Prefix != "" {
+		prefix = s.config.Prefix + "/"
+	}
+
+	var names []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := s.request(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body = io.NopCloser(bytes.NewReader(body))
+			return nil, responseError(resp, s.config.Bucket)
+		}
+
+		result := &listBucketResult{}
+		if err := xml.Unmarshal(body, result); err != nil {
+			return nil, fmt.Errorf("s3 list: %w", err)
+		}
+		for _, c := range result.Contents {
+			names = append(names, strings.TrimPrefix(c.Key, prefix))
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
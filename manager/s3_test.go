@@ -0,0 +1,258 @@
+package manager
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Set to run the S3 tests against a real server such as a local MinIO,
+// with AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and an existing bucket
+const ENV_S3_TEST_ENDPOINT = "ENV_MANAGER_TEST_S3_ENDPOINT"
+const ENV_S3_TEST_BUCKET = "ENV_MANAGER_TEST_S3_BUCKET"
+
+const FAKE_S3_BUCKET = "env-manager"
+const FAKE_S3_PAGE_SIZE = 2
+
+// fakeS3 implements the part of the S3 API used by S3Store
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func etagOf(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func (s *fakeS3) fail(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	if !strings.HasPrefix(r.Header.Get("Authorization"), SIGV4_ALGORITHM+" Credential=") ||
+		r.Header.Get("X-Amz-Content-Sha256") != sha256Hex(body) {
+		s.fail(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/"+FAKE_S3_BUCKET)
+	if path == "" || path == "/" {
+		s.list(w, r)
+		return
+	}
+	key := strings.TrimPrefix(path, "/")
+	current, exists := s.objects[key]
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if !exists {
+			s.fail(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("ETag", etagOf(current))
+		w.Write(current)
+
+	case http.MethodPut:
+		if match := r.Header.Get("If-Match"); match != "" && (!exists || match != etagOf(current)) {
+			s.fail(w, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+		if r.Header.Get("If-None-Match") == "*" && exists {
+			s.fail(w, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+		s.objects[key] = body
+		w.Header().Set("ETag", etagOf(body))
+
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		s.fail(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// list returns the keys in pages of FAKE_S3_PAGE_SIZE
+func (s *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var keys []string
+	for key := range s.objects {
+		if strings.HasPrefix(key, query.Get("prefix")) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	start, _ := strconv.Atoi(query.Get("continuation-token"))
+	end := min(start+FAKE_S3_PAGE_SIZE, len(keys))
+
+	result := listBucketResult{IsTruncated: end < len(keys)}
+	if result.IsTruncated {
+		result.NextContinuationToken = strconv.Itoa(end)
+	}
+	for _, key := range keys[start:end] {
+		result.Contents = append(result.Contents, struct {
+			Key string `xml:"Key"`
+		}{key})
+	}
+
+	out, _ := xml.Marshal(struct {
+		XMLName xml.Name `xml:"ListBucketResult"`
+		listBucketResult
+	}{listBucketResult: result})
+	w.Write(out)
+}
+
+// newTestS3Config returns a bucket on the server named by
+// ENV_MANAGER_TEST_S3_ENDPOINT, or on a fake server
+func newTestS3Config(t *testing.T) S3Config {
+	t.Helper()
+	prefix := fmt.Sprintf("test/%s", t.Name())
+
+	if endpoint := os.Getenv(ENV_S3_TEST_ENDPOINT); endpoint != "" {
+		return S3Config{Endpoint: endpoint, Bucket: os.Getenv(ENV_S3_TEST_BUCKET), Prefix: prefix}
+	}
+
+	server := httptest.NewServer(&fakeS3{objects: make(map[string][]byte)})
+	t.Cleanup(server.Close)
+	return S3Config{
+		Endpoint:        server.URL,
+		Bucket:          FAKE_S3_BUCKET,
+		Prefix:          prefix,
+		AccessKeyID:     "test",
+		SecretAccessKey: "test",
+	}
+}
+
+func newTestS3Store(t *testing.T, config S3Config) *S3Store {
+	t.Helper()
+	store, err := NewS3Store(config)
+	if err != nil {
+		t.Fatalf("NewS3Store() = %v, want %v", err, nil)
+	}
+	return store
+}
+
+// cleanS3Store removes what a test left in a real bucket
+func cleanS3Store(t *testing.T, store *S3Store) {
+	t.Cleanup(func() {
+		names, _ := store.List()
+		for _, name := range names {
+			store.Remove(name)
+		}
+	})
+}
+
+func TestS3Store(t *testing.T) {
+	store := newTestS3Store(t, newTestS3Config(t))
+	cleanS3Store(t, store)
+
+	testStore(t, store)
+
+	// Listing spans several pages
+	for i := range 5 {
+		store.WriteFile(fmt.Sprintf("page-%d", i), []byte("x"))
+	}
+	names, err := store.List()
+	if err != nil || len(names) != 7 {
+		t.Errorf("List() = %v, %v, want 7 names", names, err)
+	}
+}
+
+func TestS3StoreTimeout(t *testing.T) {
+	stalled := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-stalled
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(stalled) })
+
+	store := newTestS3Store(t, S3Config{
+		Endpoint:        server.URL,
+		Bucket:          FAKE_S3_BUCKET,
+		AccessKeyID:     "test",
+		SecretAccessKey: "test",
+	})
+	store.client.Timeout = 50 * time.Millisecond
+
+	if _, err := store.ReadFile(MANIFEST_FILE); err == nil {
+		t.Errorf("ReadFile() from a stalled server = %v, want an error", err)
+	}
+}
+
+func TestS3StoreConflict(t *testing.T) {
+	config := newTestS3Config(t)
+	first := newTestS3Store(t, config)
+	second := newTestS3Store(t, config)
+	cleanS3Store(t, first)
+
+	first.ReadFile(MANIFEST_FILE)
+	second.ReadFile(MANIFEST_FILE)
+
+	if err := first.WriteFile(MANIFEST_FILE, []byte("first")); err != nil {
+		t.Fatalf("WriteFile() = %v, want %v", err, nil)
+	}
+	// second still expects the manifest to be missing
+	if err := second.WriteFile(MANIFEST_FILE, []byte("second")); !errors.Is(err, ErrConflict) {
+		t.Fatalf("WriteFile() = %v, want %v", err, ErrConflict)
+	}
+
+	second.ReadFile(MANIFEST_FILE)
+	if err := second.WriteFile(MANIFEST_FILE, []byte("second")); err != nil {
+		t.Fatalf("WriteFile() after reading = %v, want %v", err, nil)
+	}
+	if err := first.WriteFile(MANIFEST_FILE, []byte("first again")); !errors.Is(err, ErrConflict) {
+		t.Fatalf("WriteFile() = %v, want %v", err, ErrConflict)
+	}
+}
+
+func TestS3FolderMergesConcurrentManifestChanges(t *testing.T) {
+	config := newTestS3Config(t)
+	first, err := OpenFolder(newTestS3Store(t, config))
+	if err != nil {
+		t.Fatalf("OpenFolder() = %v, want %v", err, nil)
+	}
+	second, err := OpenFolder(newTestS3Store(t, config))
+	if err != nil {
+		t.Fatalf("OpenFolder() = %v, want %v", err, nil)
+	}
+	cleanS3Store(t, first.Store().(*S3Store))
+
+	saveTestEnvFile(t, first, "staging", TEST_SECRET, "HELLO=STAGING\n")
+	// second read the manifest before staging was added
+	saveTestEnvFile(t, second, "production", TEST_SECRET, "HELLO=PRODUCTION\n")
+
+	reopened, err := OpenFolder(newTestS3Store(t, config))
+	if err != nil {
+		t.Fatalf("OpenFolder() = %v, want %v", err, nil)
+	}
+	if ids := reopened.Identifiers(); len(ids) != 2 {
+		t.Errorf("GetIdentifiers() = %v, want staging and production", ids)
+	}
+
+	if err := reopened.RotateSecret(TEST_SECRET, ROTATED_SECRET); err != nil {
+		t.Fatalf("RotateSecret() = %v, want %v", err, nil)
+	}
+	if _, err := reopened.LoadVariables("production", ROTATED_SECRET); err != nil {
+		t.Errorf("LoadVariables() = %v, want %v", err, nil)
+	}
+}
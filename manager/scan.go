@@ -0,0 +1,330 @@
+package manager
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Shorter values, or values made of a single kind of character like
+// "localhost", are too common to be reported as leaks
+const MIN_SCAN_VALUE_LENGTH = 8
+
+// Files larger than this are not searched for values
+const MAX_SCAN_FILE_SIZE = 1 << 20
+
+// Characters that can surround a value in a file
+const SCAN_SEPARATORS = " \t\r\n\"'`=:,;()[]{}<>"
+
+// Marks the hooks written by env-manager, so they can be replaced
+const HOOK_MARKER = "# Installed by env-manager"
+
+// Returned when a pre-commit hook not written by env-manager exists
+var ErrHookExists = errors.New("a pre-commit hook already exists")
+
+// Finding is a staged file that must not be committed
+type Finding struct {
+	Path   string
+	Line   int // 0 when the whole file is reported
+	Reason string
+}
+
+func (f Finding) String() string {
+	if f.Line == 0 {
+		return fmt.Sprintf("%s: %s", f.Path, f.Reason)
+	}
+	return fmt.Sprintf("%s:%d: %s", f.Path, f.Line, f.Reason)
+}
+
+// Scanner recognises restored files and stored values. It keeps only the
+// hashes of the values, never the values themselves
+type Scanner struct {
+	names   map[string]string // File name to what it holds, in any folder
+	targets map[string]string // Restore target path to what it holds
+	store   string            // Folder of a local store, whose files are encrypted
+	hashes  map[[sha256.Size]byte]string
+	lengths []int
+}
+
+// NewScanner collects the restore targets and the value hashes of every
+// configuration of the folder. Without secret only file names are checked,
+// with the restore targets recorded in the manifest
+func (f *Folder) NewScanner(secret string) (*Scanner, error) {
+	s := &Scanner{
+		names:   map[string]string{DOT_SECRET: "the env-manager secret"},
+		targets: make(map[string]string),
+		hashes:  make(map[[sha256.Size]byte]string),
+	}
+	s.names[DEFAULT_RESTORE_AS] = "a restored configuration"
+	for _, id := range f.Identifiers() {
+		if entry, _ := f.Entry(id); entry.RestoreAs != "" {
+			s.targets[scanPath(entry.RestoreAs)] = fmt.Sprintf("the restore target of %s", id)
+		}
+	}
+	if d, ok := f.store.(*DirStore); ok {
+		s.store = storeScanPath(d.Path)
+	}
+
+	if secret == "" {
+		return s, nil
+	}
+	s.addValue(secret, "the env-manager secret")
+
+	envFiles, err := f.GetEnvFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	lengths := make(map[int]bool)
+	for _, e := range envFiles {
+		if err := DecryptEnvFile(e, secret); err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Identifier(), err)
+		}
+		s.targets[scanPath(e.header.RestoreAs)] = fmt.Sprintf("the restore target of %s", e.Identifier())
+
+		d, err := e.Variables()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Identifier(), err)
+		}
+		for _, entry := range d.Entries() {
+			if entry.Key != "" && s.addValue(entry.Value, fmt.Sprintf("the value of %s from %s", entry.Key, e.Identifier())) {
+				lengths[len(entry.Value)] = true
+			}
+		}
+		e.fileContent = ""
+	}
+	lengths[len(secret)] = true
+
+	for l := range lengths {
+		s.lengths = append(s.lengths, l)
+	}
+	sort.Ints(s.lengths)
+	return s, nil
+}
+
+// addValue records the hash of value if it is distinctive enough
+func (s *Scanner) addValue(value string, description string) bool {
+	if len(value) < MIN_SCAN_VALUE_LENGTH || characterClasses(value) < 2 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(value))
+	if _, ok := s.hashes[sum]; !ok {
+		s.hashes[sum] = description
+	}
+	return true
+}
+
+func characterClasses(value string) int {
+	var lower, upper, digit, other int
+	for _, r := range value {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return lower + upper + digit + other
+}
+
+// scanPath cleans a path relative to the repository root for comparison
+func scanPath(p string) string {
+	return filepath.ToSlash(filepath.Clean(p))
+}
+
+// storeScanPath returns the folder of a local store relative to the
+// working directory, or "" if it is outside
+func storeScanPath(dir string) string {
+	if filepath.IsAbs(dir) {
+		wd, err := os.Getwd()
+		if err != nil {
+			return ""
+		}
+		if dir, err = filepath.Rel(wd, dir); err != nil {
+			return ""
+		}
+	}
+	dir = scanPath(dir)
+	if dir == "." || dir == ".." || strings.HasPrefix(dir, "../") {
+		return ""
+	}
+	return dir
+}
+
+// ScanName reports a file at the path of a restore target, named like
+// the secret or a .env file, or a backup of one. Files of the store are
+// encrypted and skipped
+func (s *Scanner) ScanName(path string) *Finding {
+	p := scanPath(path)
+	if s.store != "" && (p == s.store || strings.HasPrefix(p, s.store+"/")) {
+		return nil
+	}
+
+	base := filepath.Base(p)
+	if reason, ok := s.targets[p]; ok {
+		return &Finding{Path: path, Reason: "named like " + reason}
+	}
+	if reason, ok := s.names[base]; ok {
+		return &Finding{Path: path, Reason: "named like " + reason}
+	}
+	for target, reason := range s.targets {
+		if filepath.Dir(p) == filepath.Dir(target) && isBackupOf(base, target) {
+			return &Finding{Path: path, Reason: "a backup of " + reason}
+		}
+	}
+	for name, reason := range s.names {
+		if isBackupOf(base, name) {
+			return &Finding{Path: path, Reason: "a backup of " + reason}
+		}
+	}
+	return nil
+}
+
+// ScanContent reports every stored value found in content. Values are
+// compared by hash, between separators or the ends of a line
+func (s *Scanner) ScanContent(path string, content []byte) []Finding {
+	if len(s.lengths) == 0 || len(content) > MAX_SCAN_FILE_SIZE || isBinary(content) {
+		return nil
+	}
+
+	var findings []Finding
+	line := 1
+	for start := 0; start < len(content); start++ {
+		if start > 0 && content[start-1] == '\n' {
+			line++
+		}
+		if start > 0 && !isSeparator(content[start-1]) {
+			continue
+		}
+
+		for _, l := range s.lengths {
+			end := start + l
+			if end > len(content) {
+				break
+			}
+			if end < len(content) && !isSeparator(content[end]) {
+				continue
+			}
+			if reason, ok := s.hashes[sha256.Sum256(content[start:end])]; ok {
+				findings = append(findings, Finding{Path: path, Line: line, Reason: "contains " + reason})
+			}
+		}
+	}
+	return findings
+}
+
+func isSeparator(c byte) bool {
+	return strings.IndexByte(SCAN_SEPARATORS, c) >= 0
+}
+
+func isBinary(content []byte) bool {
+	return bytes.IndexByte(content[:min(len(content), 8000)], 0) >= 0
+}
+
+// ScanStaged checks the files staged in the git repository at dir
+func (s *Scanner) ScanStaged(dir string) ([]Finding, error) {
+	paths, err := git(dir, "diff", "--cached", "--name-only", "-z", "--diff-filter=ACMR")
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	for _, path := range strings.Split(paths, "\x00") {
+		if path == "" {
+			continue
+		}
+		if f := s.ScanName(path); f != nil {
+			findings = append(findings, *f)
+			continue
+		}
+
+		content, err := git(dir, "show", ":"+path)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, s.ScanContent(path, []byte(content))...)
+	}
+	return findings, nil
+}
+
+// ScanFiles checks files of the working tree
+func (s *Scanner) ScanFiles(paths []string) ([]Finding, error) {
+	var findings []Finding
+	for _, path := range paths {
+		if f := s.ScanName(path); f != nil {
+			findings = append(findings, *f)
+			continue
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, s.ScanContent(path, content)...)
+	}
+	return findings, nil
+}
+
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// hookScript runs the scan before every commit
+func hookScript() string {
+	return fmt.Sprintf(`#!/bin/sh
+%s. Blocks plaintext env files and leaked values.
+# Bypass once with: git commit --no-verify
+exec env-manager scan --staged
+`, HOOK_MARKER)
+}
+
+// InstallHook writes the pre-commit hook of the repository at dir and
+// returns its path. A hook written by someone else is left alone
+func InstallHook(dir string) (string, error) {
+	hooks, err := git(dir, "rev-parse", "--git-path", "hooks")
+	if err != nil {
+		return "", err
+	}
+	hooks = strings.TrimSpace(hooks)
+	if !filepath.IsAbs(hooks) {
+		hooks = filepath.Join(dir, hooks)
+	}
+	path := filepath.Join(hooks, "pre-commit")
+
+	existing, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	if err == nil && !strings.Contains(string(existing), HOOK_MARKER) {
+		return path, fmt.Errorf("%w: %s", ErrHookExists, path)
+	}
+
+	if err := os.MkdirAll(hooks, 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(hookScript()), 0755); err != nil {
+		return "", err
+	}
+	// WriteFile keeps the mode of an existing file
+	return path, os.Chmod(path, 0755)
+}
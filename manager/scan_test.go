@@ -0,0 +1,142 @@
+package manager
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestScanner(t *testing.T) *Scanner {
+	t.Chdir(t.TempDir())
+	f, err := OpenFolder(NewDirStore(DEFAULT_ENV_FOLDER))
+	if err != nil {
+		t.Fatalf("OpenFolder() = %v, want %v", err, nil)
+	}
+	saveTestEnvFile(t, f, "production", TEST_SECRET, "API_KEY=sk-live-4f9a8b7c\nHOST=localhost\nPORT=5432\n")
+
+	e := InitEnvFile("staging", "config/.env.staging")
+	e.SetContent("DB_PASSWORD=\"s3cret pass\"\n")
+	f.AddFileIdentifier(EnvFilePath("staging"), EnvFileIdentifier("staging"))
+	if err := f.SaveEnvFile(e, TEST_SECRET); err != nil {
+		t.Fatalf("SaveEnvFile() = %v, want %v", err, nil)
+	}
+
+	s, err := f.NewScanner(TEST_SECRET)
+	if err != nil {
+		t.Fatalf("NewScanner() = %v, want %v", err, nil)
+	}
+	return s
+}
+
+func TestScanName(t *testing.T) {
+	s := newTestScanner(t)
+
+	tests := map[string]bool{
+		".env":                               true,
+		"services/api/.env":                  true,
+		"config/.env.staging":                true,
+		"./config/.env.staging":              true,
+		DOT_SECRET:                           true,
+		".env.backup-20260101-120000":        true,
+		"config/.env.staging.backup-2026":    true,
+		".env.staging":                       false,
+		".env.staging.backup-2026":           false,
+		".env.example":                       false,
+		".env-manager/manifest.json":         false,
+		".env-manager/" + storedName("prod"): false,
+		".env-manager/.env":                  false,
+	}
+	for path, want := range tests {
+		if got := s.ScanName(path) != nil; got != want {
+			t.Errorf("ScanName(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestScanContent(t *testing.T) {
+	s := newTestScanner(t)
+
+	content := "host: localhost\nport: 5432\nkey: \"sk-live-4f9a8b7c\"\npassword: s3cret pass\nother: xsk-live-4f9a8b7c\n"
+	findings := s.ScanContent("config.yml", []byte(content))
+
+	if len(findings) != 2 {
+		t.Fatalf("ScanContent() = %v, want 2 findings", findings)
+	}
+	if findings[0].Line != 3 || !strings.Contains(findings[0].Reason, "API_KEY from production") {
+		t.Errorf("ScanContent() = %v, want API_KEY on line 3", findings[0])
+	}
+	if findings[1].Line != 4 || !strings.Contains(findings[1].Reason, "DB_PASSWORD from staging") {
+		t.Errorf("ScanContent() = %v, want DB_PASSWORD on line 4", findings[1])
+	}
+
+	if findings := s.ScanContent("secret.txt", []byte(TEST_SECRET)); len(findings) != 1 {
+		t.Errorf("ScanContent() with the secret = %v, want 1 finding", findings)
+	}
+}
+
+func TestScanWithoutSecret(t *testing.T) {
+	f := newTestFolder(t)
+	saveTestEnvFile(t, f, "production", TEST_SECRET, "API_KEY=sk-live-4f9a8b7c\n")
+
+	s, err := f.NewScanner("")
+	if err != nil {
+		t.Fatalf("NewScanner() = %v, want %v", err, nil)
+	}
+	if s.ScanName(".env") == nil {
+		t.Errorf("ScanName() without secret = %v, want a finding", nil)
+	}
+	if findings := s.ScanContent("a.txt", []byte("sk-live-4f9a8b7c")); len(findings) != 0 {
+		t.Errorf("ScanContent() without secret = %v, want nothing", findings)
+	}
+}
+
+func TestScanStagedAndInstallHook(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	s := newTestScanner(t)
+
+	dir := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	git("init", "-q")
+	os.WriteFile(filepath.Join(dir, ".env"), []byte("A=1\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte("const key = \"sk-live-4f9a8b7c\"\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "readme.md"), []byte("# docs\n"), 0644)
+	git("add", ".")
+
+	// Only the staged version is checked
+	os.WriteFile(filepath.Join(dir, "readme.md"), []byte("sk-live-4f9a8b7c\n"), 0644)
+
+	findings, err := s.ScanStaged(dir)
+	if err != nil {
+		t.Fatalf("ScanStaged() = %v, want %v", err, nil)
+	}
+	if len(findings) != 2 || findings[0].Path != ".env" || findings[1].Path != "main.go" || findings[1].Line != 1 {
+		t.Errorf("ScanStaged() = %v, want .env and main.go:1", findings)
+	}
+
+	path, err := InstallHook(dir)
+	if err != nil {
+		t.Fatalf("InstallHook() = %v, want %v", err, nil)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm()&0100 == 0 {
+		t.Errorf("InstallHook() did not write an executable hook: %v", err)
+	}
+
+	// Installing again replaces our hook, a foreign one is kept
+	if _, err := InstallHook(dir); err != nil {
+		t.Errorf("InstallHook() again = %v, want %v", err, nil)
+	}
+	os.WriteFile(path, []byte("#!/bin/sh\nmake lint\n"), 0755)
+	if _, err := InstallHook(dir); !errors.Is(err, ErrHookExists) {
+		t.Errorf("InstallHook() over a foreign hook = %v, want %v", err, ErrHookExists)
+	}
+}
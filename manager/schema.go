@@ -0,0 +1,304 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Schema file inside the env-manager folder
+const SCHEMA_FILE = "schema.yaml"
+
+// Section of the schema that applies to every configuration
+const SCHEMA_ALL = "*"
+
+// Variable types of the schema
+const (
+	SCHEMA_STRING = "string"
+	SCHEMA_URL    = "url"
+	SCHEMA_INT    = "int"
+	SCHEMA_BOOL   = "bool"
+	SCHEMA_ENUM   = "enum"
+	SCHEMA_REGEX  = "regex"
+)
+
+// Returned when a configuration does not match the schema
+var ErrInvalidConfig = errors.New("configuration does not match the schema")
+
+// ValidationError lists why a configuration does not match the schema.
+// Problems never include the values
+type ValidationError struct {
+	Identifier string
+	Problems   []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %v: %s", e.Identifier, ErrInvalidConfig, strings.Join(e.Problems, "; "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidConfig
+}
+
+// VariableRule describes one variable of the schema
+type VariableRule struct {
+	Key      string
+	Type     string
+	Required bool
+	Values   []string       // Allowed values of an enum
+	Pattern  *regexp.Regexp // Whole value match of a regex
+}
+
+// Schema holds the variable rules of each identifier. The rules of the
+// "*" section apply to every configuration:
+//
+//	"*":
+//	  DATABASE_URL: url
+//	production:
+//	  PORT: int
+//	  LOG_LEVEL:
+//	    type: enum
+//	    values: [debug, info, warn]
+//	  DEBUG:
+//	    type: bool
+//	    required: false
+type Schema struct {
+	sections map[string][]VariableRule
+}
+
+// ParseSchema reads the YAML content of a schema file
+func ParseSchema(content string) (*Schema, error) {
+	v, err := parseYAML(content)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Schema{sections: make(map[string][]VariableRule)}
+	if v == nil {
+		return s, nil
+	}
+
+	root, ok := v.(*yamlMap)
+	if !ok {
+		return nil, errors.New("invalid schema: expected a map of identifiers")
+	}
+
+	for _, identifier := range root.keys {
+		variables, ok := root.values[identifier].(*yamlMap)
+		if !ok {
+			return nil, fmt.Errorf("invalid schema: %s: expected a map of variables", identifier)
+		}
+
+		for _, key := range variables.keys {
+			rule, err := parseVariableRule(key, variables.values[key])
+			if err != nil {
+				return nil, fmt.Errorf("invalid schema: %s.%s: %w", identifier, key, err)
+			}
+			s.sections[identifier] = append(s.sections[identifier], rule)
+		}
+	}
+
+	return s, nil
+}
+
+// parseVariableRule reads either a bare type or a map of options
+func parseVariableRule(key string, v any) (VariableRule, error) {
+	rule := VariableRule{Key: key, Type: SCHEMA_STRING, Required: true}
+	if err := ValidateKey(key); err != nil {
+		return rule, err
+	}
+
+	var options *yamlMap
+	switch v := v.(type) {
+	case nil:
+		return rule, nil
+	case string:
+		options = newYAMLMap()
+		options.set("type", v)
+	case *yamlMap:
+		options = v
+	default:
+		return rule, errors.New("expected a type or a map")
+	}
+
+	for _, option := range options.keys {
+		value := options.values[option]
+		switch option {
+		case "type":
+			t, ok := value.(string)
+			if !ok {
+				return rule, errors.New("type must be a string")
+			}
+			rule.Type = t
+
+		case "required":
+			s, _ := value.(string)
+			required, err := strconv.ParseBool(s)
+			if err != nil {
+				return rule, errors.New("required must be true or false")
+			}
+			rule.Required = required
+
+		case "values":
+			items, ok := value.([]any)
+			if !ok {
+				return rule, errors.New("values must be a list")
+			}
+			for _, item := range items {
+				s, ok := item.(string)
+				if !ok {
+					return rule, errors.New("values must be strings")
+				}
+				rule.Values = append(rule.Values, s)
+			}
+
+		case "pattern":
+			s, ok := value.(string)
+			if !ok {
+				return rule, errors.New("pattern must be a string")
+			}
+			pattern, err := regexp.Compile("^(?:" + s + ")$")
+			if err != nil {
+				return rule, err
+			}
+			rule.Pattern = pattern
+
+		default:
+			return rule, fmt.Errorf("unknown option %s", option)
+		}
+	}
+
+	switch rule.Type {
+	case SCHEMA_STRING, SCHEMA_URL, SCHEMA_INT, SCHEMA_BOOL:
+	case SCHEMA_ENUM:
+		if len(rule.Values) == 0 {
+			return rule, errors.New("enum needs values")
+		}
+	case SCHEMA_REGEX:
+		if rule.Pattern == nil {
+			return rule, errors.New("regex needs a pattern")
+		}
+	default:
+		return rule, fmt.Errorf("unknown type %s", rule.Type)
+	}
+
+	return rule, nil
+}
+
+// Rules returns the rules that apply to identifier. Rules of its own
+// section replace the "*" rules of the same variable
+func (s *Schema) Rules(identifier string) []VariableRule {
+	own := s.sections[identifier]
+	rules := make([]VariableRule, 0, len(own)+len(s.sections[SCHEMA_ALL]))
+
+	for _, rule := range s.sections[SCHEMA_ALL] {
+		if !slices.ContainsFunc(own, func(r VariableRule) bool { return r.Key == rule.Key }) {
+			rules = append(rules, rule)
+		}
+	}
+	return append(rules, own...)
+}
+
+// Validate checks the variables of a configuration. A required variable
+// must be set and not empty; empty optional variables are not checked
+func (s *Schema) Validate(identifier string, d *Dotenv) error {
+	vars := d.Map()
+
+	var problems []string
+	for _, rule := range s.Rules(identifier) {
+		value := vars[rule.Key]
+		if value == "" {
+			if rule.Required {
+				problems = append(problems, fmt.Sprintf("%s is required", rule.Key))
+			}
+			continue
+		}
+
+		if problem := rule.check(value); problem != "" {
+			problems = append(problems, fmt.Sprintf("%s %s", rule.Key, problem))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Identifier: identifier, Problems: problems}
+	}
+	return nil
+}
+
+// check returns what is wrong with value, without quoting it
+func (r VariableRule) check(value string) string {
+	switch r.Type {
+	case SCHEMA_URL:
+		u, err := url.Parse(value)
+		if err != nil || u.Scheme == "" || (u.Host == "" && u.Opaque == "") {
+			return "is not a url"
+		}
+	case SCHEMA_INT:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return "is not an int"
+		}
+	case SCHEMA_BOOL:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return "is not a bool"
+		}
+	case SCHEMA_ENUM:
+		if !slices.Contains(r.Values, value) {
+			return "must be one of " + strings.Join(r.Values, ", ")
+		}
+	case SCHEMA_REGEX:
+		if !r.Pattern.MatchString(value) {
+			return "does not match " + strings.TrimSuffix(strings.TrimPrefix(r.Pattern.String(), "^(?:"), ")$")
+		}
+	}
+	return ""
+}
+
+/// Functions
+
+// LoadSchema reads the schema of the folder. It returns nil if the
+// folder has none
+func (f *Folder) LoadSchema() (*Schema, error) {
+	content, err := f.store.ReadFile(SCHEMA_FILE)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseSchema(string(content))
+}
+
+// validate checks a decrypted configuration against the schema, if any
+func (f *Folder) validate(e *EnvFile) error {
+	schema, err := f.LoadSchema()
+	if err != nil || schema == nil {
+		return err
+	}
+
+	d, err := e.Variables()
+	if err != nil {
+		return err
+	}
+	return schema.Validate(e.header.Identifier, d)
+}
+
+// ValidateEnvFile decrypts a stored configuration in memory and checks it
+// against the schema
+func (f *Folder) ValidateEnvFile(identifier string, secret string) error {
+	e, err := f.GetEnvFile(identifier)
+	if err != nil {
+		return err
+	}
+
+	if err := DecryptEnvFile(e, secret); err != nil {
+		return err
+	}
+
+	return f.validate(e)
+}
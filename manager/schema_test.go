@@ -0,0 +1,114 @@
+package manager
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const TEST_SCHEMA = `# Required by every configuration
+"*":
+  DATABASE_URL: url
+  DEBUG:
+    type: bool
+    required: false
+production:
+  PORT: int
+  LOG_LEVEL:
+    type: enum
+    values: [debug, info, warn]
+  API_KEY:
+    type: regex
+    pattern: sk-live-[a-z0-9]+
+  DEBUG: bool
+`
+
+func TestSchemaValidate(t *testing.T) {
+	schema, err := ParseSchema(TEST_SCHEMA)
+	if err != nil {
+		t.Fatalf("ParseSchema() = %v, want %v", err, nil)
+	}
+
+	tests := []struct {
+		identifier string
+		content    string
+		problems   []string
+	}{
+		{"staging", "DATABASE_URL=postgres://db:5432/app\n", nil},
+		{"staging", "DATABASE_URL=postgres://db/app\nDEBUG=\n", nil},
+		{"staging", "DATABASE_URL=not a url\nDEBUG=maybe\n", []string{"DATABASE_URL is not a url", "DEBUG is not a bool"}},
+		{"production", "DATABASE_URL=https://db\nPORT=80\nLOG_LEVEL=info\nAPI_KEY=sk-live-abc1\nDEBUG=false\n", nil},
+		{"production", "DATABASE_URL=https://db\nPORT=eighty\nLOG_LEVEL=trace\nAPI_KEY=xsk-live-abc1\n", []string{
+			"PORT is not an int",
+			"LOG_LEVEL must be one of debug, info, warn",
+			"API_KEY does not match sk-live-[a-z0-9]+",
+			"DEBUG is required",
+		}},
+	}
+
+	for _, tt := range tests {
+		d, _ := ParseDotenv(tt.content)
+		err := schema.Validate(tt.identifier, d)
+
+		var invalid *ValidationError
+		if tt.problems == nil {
+			if err != nil {
+				t.Errorf("Validate(%s, %q) = %v, want %v", tt.identifier, tt.content, err, nil)
+			}
+			continue
+		}
+		if !errors.As(err, &invalid) || !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("Validate(%s, %q) = %v, want %v", tt.identifier, tt.content, err, ErrInvalidConfig)
+			continue
+		}
+		if strings.Join(invalid.Problems, "\n") != strings.Join(tt.problems, "\n") {
+			t.Errorf("Validate(%s, %q) = %q, want %q", tt.identifier, tt.content, invalid.Problems, tt.problems)
+		}
+	}
+}
+
+func TestParseSchemaErrors(t *testing.T) {
+	tests := []string{
+		"production: [PORT]\n",
+		"production:\n  PORT: number\n",
+		"production:\n  LEVEL: enum\n",
+		"production:\n  KEY:\n    type: regex\n    pattern: \"[\"\n",
+		"production:\n  PORT:\n    type: int\n    default: 80\n",
+		"production:\n  1PORT: int\n",
+	}
+
+	for _, content := range tests {
+		if _, err := ParseSchema(content); err == nil {
+			t.Errorf("ParseSchema(%q) = %v, want an error", content, nil)
+		}
+	}
+}
+
+func TestSaveEnvFileValidatesSchema(t *testing.T) {
+	f := newTestFolder(t)
+	saveTestEnvFile(t, f, "production", TEST_SECRET, "PORT=80\n")
+
+	f.Store().WriteFile(SCHEMA_FILE, []byte("production:\n  PORT: int\n"))
+
+	if err := f.SetVariable("production", "PORT", "eighty", TEST_SECRET); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("SetVariable() = %v, want %v", err, ErrInvalidConfig)
+	}
+	if err := f.UnsetVariable("production", "PORT", TEST_SECRET); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("UnsetVariable() = %v, want %v", err, ErrInvalidConfig)
+	}
+	if err := f.ValidateEnvFile("production", TEST_SECRET); err != nil {
+		t.Errorf("ValidateEnvFile() = %v, want %v", err, nil)
+	}
+
+	// The refused changes were not saved
+	d, err := f.LoadVariables("production", TEST_SECRET)
+	if err != nil || d.Map()["PORT"] != "80" {
+		t.Errorf("LoadVariables() = %v, %v, want PORT=80", d, err)
+	}
+
+	e := InitEnvFile("staging", DEFAULT_RESTORE_AS)
+	e.SetContent("PORT=eighty\n")
+	if err := f.SaveEnvFile(e, TEST_SECRET); err != nil {
+		t.Errorf("SaveEnvFile() of an identifier without rules = %v, want %v", err, nil)
+	}
+}
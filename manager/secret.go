@@ -1,8 +1,11 @@
 package manager
 
 import (
-	"io"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -19,35 +22,48 @@ func (s *secret) GetSecret() string {
 	return s.secret
 }
 
-func getSecretFromFile() *string {
-	if _, err := os.Stat(DOT_SECRET); os.IsNotExist(err) {
-		return nil
-	}
+func getSecretFromFile(dir string) (*string, error) {
+	return readSecretFile(filepath.Join(dir, DOT_SECRET))
+}
 
-	/// If found, read the file
-	/// and set the secret
-	f, err := os.Open(DOT_SECRET)
+// ReadSecretFile reads a secret from the file at path, ignoring
+// surrounding whitespace
+func ReadSecretFile(path string) (string, error) {
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
 
+	secret, err := readSecretFile(path)
 	if err != nil {
-		panic(err)
+		return "", err
+	}
+	if secret == nil {
+		return "", fmt.Errorf("%w: secret file is empty: %s", ErrNoSecret, path)
 	}
 
-	defer f.Close()
+	return *secret, nil
+}
 
-	fileContent, err := io.ReadAll(f)
+func readSecretFile(path string) (*string, error) {
+	/// If found, read the file
+	/// and set the secret
+	fileContent, err := os.ReadFile(path)
 
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	secret := string(fileContent)
 	secret = strings.TrimSpace(secret)
 
 	if secret == "" {
-		return nil
+		return nil, nil
 	}
 
-	return &secret
+	return &secret, nil
 }
 
 func getSecretFromEnv() *string {
@@ -60,24 +76,39 @@ func getSecretFromEnv() *string {
 	return &secret
 }
 
-func (s *secret) findSecret() {
+func (s *secret) findSecret(dir string) error {
 	/// Only support secret from file for now
 	/// If not found, search if a file is present
 	_secret := getSecretFromEnv()
 
 	if _secret == nil {
-		_secret = getSecretFromFile()
+		var err error
+		_secret, err = getSecretFromFile(dir)
+		if err != nil {
+			return err
+		}
 	}
 
 	if _secret == nil {
-		panic("No secret found")
+		return fmt.Errorf("%w: set %s or create a %s file", ErrNoSecret, ENV_SECRET, DOT_SECRET)
 	}
 
 	s.secret = *_secret
+	return nil
+}
+
+// InitSecret reads the secret from ENV_MANAGER_SECRET or the .secret
+// file. It returns ErrNoSecret when neither is set
+func InitSecret() (secret, error) {
+	return InitSecretFrom(".")
 }
 
-func InitSecret() secret {
+// InitSecretFrom works like InitSecret, reading the .secret file
+// from dir instead of the working directory
+func InitSecretFrom(dir string) (secret, error) {
 	s := secret{}
-	s.findSecret()
-	return s
+	if err := s.findSecret(dir); err != nil {
+		return s, err
+	}
+	return s, nil
 }
@@ -1,6 +1,7 @@
 package manager
 
 import (
+	"errors"
 	"os"
 	"testing"
 )
@@ -10,29 +11,25 @@ func createDotSecretFile(secretValue string) error {
 	return os.WriteFile(DOT_SECRET, []byte(secretValue), 0644)
 }
 
-// Helper function to clean up by removing the .secret file
-func cleanupDotSecretFile() {
-	os.Remove(DOT_SECRET)
-}
-
-// Clear env variable and .secret file
-func setup() {
-	os.Unsetenv(ENV_SECRET)
-	cleanupDotSecretFile()
+// Clear env variable and work in an empty folder
+func setup(t *testing.T) {
+	t.Setenv(ENV_SECRET, "")
+	t.Chdir(t.TempDir())
 }
 
 // TestInitSecretFromFile tests InitSecret function when the secret is read from a file
 func TestInitSecretFromFile(t *testing.T) {
-	setup()
+	setup(t)
 	expectedSecret := "fileSecret"
 	err := createDotSecretFile(expectedSecret)
 	if err != nil {
 		t.Fatalf("Unable to create .secret file: %v", err)
 	}
 
-	defer cleanupDotSecretFile()
-
-	s := InitSecret()
+	s, err := InitSecret()
+	if err != nil {
+		t.Fatalf("InitSecret() = %v, want %v", err, nil)
+	}
 
 	if s.GetSecret() != expectedSecret {
 		t.Errorf("Expected secret %s, got %s", expectedSecret, s.GetSecret())
@@ -42,17 +39,24 @@ func TestInitSecretFromFile(t *testing.T) {
 // TestInitSecretFromEnv tests InitSecret function when the secret is read from an environment variable
 func TestInitSecretFromEnv(t *testing.T) {
 	expectedSecret := "envSecret"
-	os.Setenv(ENV_SECRET, expectedSecret)
-	defer os.Unsetenv(ENV_SECRET)
-
-	// Ensure no .secret file exists to test environment variable functionality
-	cleanupDotSecretFile()
+	setup(t)
+	t.Setenv(ENV_SECRET, expectedSecret)
 
-	s := InitSecret()
+	s, err := InitSecret()
+	if err != nil {
+		t.Fatalf("InitSecret() = %v, want %v", err, nil)
+	}
 
 	if s.GetSecret() != expectedSecret {
 		t.Errorf("Expected secret %s, got %s", expectedSecret, s.GetSecret())
 	}
 }
 
-// Additional tests can be added to cover more scenarios, such as when neither the file nor the environment variable is set.
+// TestInitSecretMissing tests InitSecret function when neither the file nor the environment variable is set
+func TestInitSecretMissing(t *testing.T) {
+	setup(t)
+
+	if _, err := InitSecret(); !errors.Is(err, ErrNoSecret) {
+		t.Errorf("InitSecret() = %v, want %v", err, ErrNoSecret)
+	}
+}
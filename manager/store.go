@@ -0,0 +1,188 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Store holds the files of an env-manager folder: the manifest, the
+// encrypted configurations and the recipients. Names are relative to the
+// folder and missing files are reported with fs.ErrNotExist
+type Store interface {
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte) error
+	Remove(name string) error
+	Rename(oldName string, newName string) error
+	// List returns the names of every file, sorted
+	List() ([]string, error)
+}
+
+// DirStore keeps the files in a local directory
+type DirStore struct {
+	Path string
+}
+
+func NewDirStore(path string) *DirStore {
+	return &DirStore{Path: path}
+}
+
+func (s *DirStore) path(name string) (string, error) {
+	if !fs.ValidPath(name) || name == "." {
+		return "", fmt.Errorf("invalid file name %q", name)
+	}
+	return filepath.Join(s.Path, filepath.FromSlash(name)), nil
+}
+
+func (s *DirStore) ReadFile(name string) ([]byte, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+func (s *DirStore) WriteFile(name string, data []byte) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return WriteFileAtomic(path, data, 0644)
+}
+
+func (s *DirStore) Remove(name string) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func (s *DirStore) Rename(oldName string, newName string) error {
+	oldPath, err := s.path(oldName)
+	if err != nil {
+		return err
+	}
+	newPath, err := s.path(newName)
+	if err != nil {
+		return err
+	}
+	return os.Rename(oldPath, newPath)
+}
+
+func (s *DirStore) List() ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(s.Path, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		name, err := filepath.Rel(s.Path, path)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(name))
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *DirStore) String() string {
+	return s.Path
+}
+
+// MemoryStore keeps the files in memory. It is safe for concurrent use
+type MemoryStore struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{files: make(map[string][]byte)}
+}
+
+func (s *MemoryStore) ReadFile(name string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (s *MemoryStore) WriteFile(name string, data []byte) error {
+	if !fs.ValidPath(name) || name == "." {
+		return fmt.Errorf("invalid file name %q", name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.files[name] = append([]byte(nil), data...)
+	return nil
+}
+
+func (s *MemoryStore) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.files[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(s.files, name)
+	return nil
+}
+
+func (s *MemoryStore) Rename(oldName string, newName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.files[oldName]
+	if !ok {
+		return &fs.PathError{Op: "rename", Path: oldName, Err: fs.ErrNotExist}
+	}
+	delete(s.files, oldName)
+	s.files[newName] = data
+	return nil
+}
+
+func (s *MemoryStore) List() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.files))
+	for name := range s.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *MemoryStore) String() string {
+	return "memory"
+}
+
+// storedName is the name of the encrypted file of a configuration
+func storedName(identifier string) string {
+	return SAVED_PREFIX + identifier
+}
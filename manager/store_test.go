@@ -0,0 +1,96 @@
+package manager
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+)
+
+func TestStores(t *testing.T) {
+	stores := map[string]Store{
+		"dir":    NewDirStore(t.TempDir()),
+		"memory": NewMemoryStore(),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			testStore(t, store)
+		})
+	}
+}
+
+// testStore checks the behaviour every Store must have, starting empty
+func testStore(t *testing.T, store Store) {
+	t.Helper()
+
+	if _, err := store.ReadFile("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ReadFile() = %v, want %v", err, fs.ErrNotExist)
+	}
+
+	if err := store.WriteFile("b.json", []byte("b")); err != nil {
+		t.Fatalf("WriteFile() = %v, want %v", err, nil)
+	}
+	if err := store.WriteFile("a.json", []byte("a")); err != nil {
+		t.Fatalf("WriteFile() = %v, want %v", err, nil)
+	}
+
+	if err := store.Rename("b.json", "c.json"); err != nil {
+		t.Fatalf("Rename() = %v, want %v", err, nil)
+	}
+	if content, err := store.ReadFile("c.json"); err != nil || string(content) != "b" {
+		t.Errorf("ReadFile() = %q, %v, want %q, %v", content, err, "b", nil)
+	}
+
+	// Names can have folders
+	if err := store.WriteFile("history/a.json", []byte("h")); err != nil {
+		t.Fatalf("WriteFile() = %v, want %v", err, nil)
+	}
+	if content, err := store.ReadFile("history/a.json"); err != nil || string(content) != "h" {
+		t.Errorf("ReadFile() = %q, %v, want %q, %v", content, err, "h", nil)
+	}
+
+	names, err := store.List()
+	if err != nil || strings.Join(names, ",") != "a.json,c.json,history/a.json" {
+		t.Errorf("List() = %v, %v, want %v, %v", names, err, "[a.json c.json history/a.json]", nil)
+	}
+
+	if err := store.Remove("a.json"); err != nil {
+		t.Fatalf("Remove() = %v, want %v", err, nil)
+	}
+	if err := store.Remove("a.json"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Remove() = %v, want %v", err, fs.ErrNotExist)
+	}
+
+	if err := store.WriteFile("../escape", []byte("x")); err == nil {
+		t.Errorf("WriteFile() accepted a name outside the store")
+	}
+}
+
+func TestOpenFolderRoundTrip(t *testing.T) {
+	store := NewMemoryStore()
+	f, err := OpenFolder(store)
+	if err != nil {
+		t.Fatalf("OpenFolder() = %v, want %v", err, nil)
+	}
+	saveTestEnvFile(t, f, "production", TEST_SECRET, "HELLO=WORLD\n")
+
+	// A second handle on the same store sees the manifest
+	reopened, err := OpenFolder(store)
+	if err != nil {
+		t.Fatalf("OpenFolder() = %v, want %v", err, nil)
+	}
+
+	d, err := reopened.LoadVariables("production", TEST_SECRET)
+	if err != nil {
+		t.Fatalf("LoadVariables() = %v, want %v", err, nil)
+	}
+	if got, _ := d.Get("HELLO"); got != "WORLD" {
+		t.Errorf("LoadVariables() HELLO = %v, want %v", got, "WORLD")
+	}
+
+	store.WriteFile(MANIFEST_FILE, []byte("not json"))
+	if _, err := OpenFolder(store); err == nil {
+		t.Errorf("OpenFolder() accepted a corrupt manifest")
+	}
+}
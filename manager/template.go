@@ -0,0 +1,86 @@
+package manager
+
+import (
+	"strings"
+)
+
+// Default file written by the template command
+const DEFAULT_TEMPLATE_AS = ".env.example"
+
+// Placeholder of variables the schema does not describe
+const TEMPLATE_PLACEHOLDER = "<value>"
+
+// isHeaderLine reports whether the entry is an env-manager header
+func isHeaderLine(e *DotenvEntry) bool {
+	line := strings.TrimSpace(e.raw)
+	return e.Key == "" && (strings.HasPrefix(line, strings.TrimSpace(IDENTIFIER_HEADER)) ||
+		strings.HasPrefix(line, strings.TrimSpace(RESTORE_AS_HEADER)))
+}
+
+// placeholder describes the value a variable expects, from its rule when
+// the schema has one
+func placeholder(rule *VariableRule) string {
+	if rule == nil {
+		return TEMPLATE_PLACEHOLDER
+	}
+
+	hint := rule.Type
+	switch rule.Type {
+	case SCHEMA_BOOL:
+		hint = "true|false"
+	case SCHEMA_ENUM:
+		hint = strings.Join(rule.Values, "|")
+	case SCHEMA_REGEX:
+		hint = strings.TrimSuffix(strings.TrimPrefix(rule.Pattern.String(), "^(?:"), ")$")
+	}
+
+	if !rule.Required {
+		hint += ", optional"
+	}
+	return "<" + hint + ">"
+}
+
+// Template returns the configuration with every value replaced by a
+// placeholder. Keys, comments, blank lines and order are kept and the
+// env-manager headers are removed. schema may be nil
+func Template(d *Dotenv, identifier string, schema *Schema) *Dotenv {
+	rules := make(map[string]*VariableRule)
+	if schema != nil {
+		for _, rule := range schema.Rules(identifier) {
+			rules[rule.Key] = &rule
+		}
+	}
+
+	t := &Dotenv{}
+	for _, e := range d.entries {
+		if isHeaderLine(e) {
+			continue
+		}
+
+		entry := *e
+		if entry.Key != "" {
+			entry.Value = placeholder(rules[entry.Key])
+			entry.render()
+		}
+		t.entries = append(t.entries, &entry)
+	}
+	return t
+}
+
+/// Functions
+
+// TemplateEnvFile decrypts a stored configuration in memory and returns
+// its template, with the hints of the folder schema
+func (f *Folder) TemplateEnvFile(identifier string, secret string) (string, error) {
+	d, err := f.LoadVariables(identifier, secret)
+	if err != nil {
+		return "", err
+	}
+
+	schema, err := f.LoadSchema()
+	if err != nil {
+		return "", err
+	}
+
+	return Template(d, identifier, schema).String(), nil
+}
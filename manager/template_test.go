@@ -0,0 +1,61 @@
+package manager
+
+import (
+	"testing"
+)
+
+func TestTemplate(t *testing.T) {
+	content := getEnvFileContent("production",
+		"# Database",
+		"DATABASE_URL=postgres://user:pw@db/app # primary",
+		"",
+		"export PORT=80",
+		`LOG_LEVEL="info"`,
+		"DEBUG=false",
+		`CERT="line one`,
+		`line two"`,
+		"API_KEY=sk-live-abc1",
+	)
+	d, err := ParseDotenv(content)
+	if err != nil {
+		t.Fatalf("ParseDotenv() = %v, want %v", err, nil)
+	}
+
+	schema, err := ParseSchema(TEST_SCHEMA)
+	if err != nil {
+		t.Fatalf("ParseSchema() = %v, want %v", err, nil)
+	}
+
+	got := Template(d, "production", schema).String()
+	want := "# Database\n" +
+		"DATABASE_URL=<url> # primary\n" +
+		"\n" +
+		"export PORT=<int>\n" +
+		`LOG_LEVEL="<debug|info|warn>"` + "\n" +
+		"DEBUG=<true|false>\n" +
+		"CERT=\"<value>\"\n" +
+		"API_KEY=<sk-live-[a-z0-9]+>\n"
+	if got != want {
+		t.Errorf("Template() = %q, want %q", got, want)
+	}
+
+	// Without schema every value gets the same placeholder
+	got = Template(d, "staging", nil).String()
+	if d, _ := ParseDotenv(got); len(d.Keys()) != 6 || d.Map()["DEBUG"] != TEMPLATE_PLACEHOLDER {
+		t.Errorf("Template() without schema = %q, want every value replaced", got)
+	}
+}
+
+func TestTemplateEnvFile(t *testing.T) {
+	f := newTestFolder(t)
+	saveTestEnvFile(t, f, "staging", TEST_SECRET, "# keys\nAPI_KEY=secret\n")
+	f.Store().WriteFile(SCHEMA_FILE, []byte("\"*\":\n  DEBUG:\n    type: bool\n    required: false\n"))
+
+	got, err := f.TemplateEnvFile("staging", TEST_SECRET)
+	if err != nil {
+		t.Fatalf("TemplateEnvFile() = %v, want %v", err, nil)
+	}
+	if want := "# keys\nAPI_KEY=<value>\n"; got != want {
+		t.Errorf("TemplateEnvFile() = %q, want %q", got, want)
+	}
+}
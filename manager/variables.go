@@ -0,0 +1,112 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Returned when unsetting a variable the configuration does not have
+var ErrVariableNotFound = errors.New("variable not found")
+
+// UpdateEnvFile decrypts a stored configuration in memory, lets update
+// change its variables and saves it encrypted again. The plaintext is
+// never written to disk.
+func (f *Folder) UpdateEnvFile(identifier string, secret string, update func(d *Dotenv) error) error {
+	e, err := f.GetEnvFile(identifier)
+	if err != nil {
+		return err
+	}
+
+	if err := DecryptEnvFile(e, secret); err != nil {
+		return err
+	}
+
+	d, err := e.Variables()
+	if err != nil {
+		return err
+	}
+
+	if err := update(d); err != nil {
+		return err
+	}
+
+	e.SetVariables(d)
+	return f.SaveEnvFile(e, secret)
+}
+
+// SetVariable sets a single variable of a stored configuration
+func (f *Folder) SetVariable(identifier string, key string, value string, secret string) error {
+	return f.UpdateEnvFile(identifier, secret, func(d *Dotenv) error {
+		return d.Set(key, value)
+	})
+}
+
+// UnsetVariable removes a single variable from a stored configuration
+func (f *Folder) UnsetVariable(identifier string, key string, secret string) error {
+	return f.UpdateEnvFile(identifier, secret, func(d *Dotenv) error {
+		if !d.Unset(key) {
+			return fmt.Errorf("%w: %s", ErrVariableNotFound, key)
+		}
+		return nil
+	})
+}
+
+// LoadVariables decrypts a stored configuration in memory and returns
+// its variables
+func (f *Folder) LoadVariables(identifier string, secret string) (*Dotenv, error) {
+	e, err := f.GetEnvFile(identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := DecryptEnvFile(e, secret); err != nil {
+		return nil, err
+	}
+
+	return e.Variables()
+}
+
+func UpdateEnvFile(identifier string, secret string, folder *string, update func(d *Dotenv) error) error {
+	f, err := GetOrCreateFolder(folder)
+	if err != nil {
+		return err
+	}
+	return f.UpdateEnvFile(identifier, secret, update)
+}
+
+func LoadVariables(identifier string, secret string, folder *string) (*Dotenv, error) {
+	f, err := GetOrCreateFolder(folder)
+	if err != nil {
+		return nil, err
+	}
+	return f.LoadVariables(identifier, secret)
+}
+
+// MergeEnviron adds the variables to an environment in the os.Environ
+// format. Variables replace entries of base with the same name.
+func MergeEnviron(base []string, d *Dotenv) []string {
+	vars := d.Map()
+	merged := make([]string, 0, len(base)+len(vars))
+	replaced := make(map[string]bool)
+
+	for _, kv := range base {
+		key, _, _ := strings.Cut(kv, "=")
+		if value, ok := vars[key]; ok {
+			if !replaced[key] {
+				merged = append(merged, key+"="+value)
+				replaced[key] = true
+			}
+			continue
+		}
+		merged = append(merged, kv)
+	}
+
+	for _, key := range d.Keys() {
+		if !replaced[key] {
+			merged = append(merged, key+"="+vars[key])
+		}
+	}
+
+	return merged
+}
@@ -0,0 +1,58 @@
+package manager
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSetAndUnsetVariable(t *testing.T) {
+	f := newTestFolder(t)
+	saveTestEnvFile(t, f, "production", TEST_SECRET, "# keys\nAPI_KEY=old\nDEBUG=true\n")
+
+	if err := f.SetVariable("production", "API_KEY", "new value", TEST_SECRET); err != nil {
+		t.Fatalf("SetVariable() = %v, want %v", err, nil)
+	}
+
+	if err := f.UnsetVariable("production", "DEBUG", TEST_SECRET); err != nil {
+		t.Fatalf("UnsetVariable() = %v, want %v", err, nil)
+	}
+
+	if err := f.UnsetVariable("production", "MISSING", TEST_SECRET); !errors.Is(err, ErrVariableNotFound) {
+		t.Errorf("UnsetVariable() = %v, want %v", err, ErrVariableNotFound)
+	}
+
+	e, err := decryptStored(t, f, "production", TEST_SECRET)
+	if err != nil {
+		t.Fatalf("decrypt() = %v, want %v", err, nil)
+	}
+
+	want := getEnvFileContent("production", "# keys", `API_KEY="new value"`)
+	if e.fileContent != want {
+		t.Errorf("SetVariable() content = %q, want %q", e.fileContent, want)
+	}
+
+	// Only the manifest, the encrypted file and its history are in the folder
+	names, _ := f.Store().List()
+	for _, name := range names {
+		content, _ := f.Store().ReadFile(name)
+		if strings.Contains(string(content), "new value") {
+			t.Errorf("SetVariable() wrote plaintext to %s", name)
+		}
+	}
+	if len(names) != 3 {
+		t.Errorf("SetVariable() left %v in the folder, want 3 files", names)
+	}
+}
+
+func TestMergeEnviron(t *testing.T) {
+	d, _ := ParseDotenv("API_KEY=stored\nNEW=value with = sign\n")
+	base := []string{"PATH=/usr/bin", "API_KEY=from-shell", "HOME=/root"}
+
+	got := MergeEnviron(base, d)
+	want := []string{"PATH=/usr/bin", "API_KEY=stored", "HOME=/root", "NEW=value with = sign"}
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("MergeEnviron() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,119 @@
+package manager
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Upper bound of the values of a parsed document once aliases are
+// expanded, so nested aliases cannot make a small file use all memory
+const MAX_YAML_VALUES = 10000
+
+// yamlMap is a YAML mapping that keeps the order of its keys
+type yamlMap struct {
+	keys   []string
+	values map[string]any
+}
+
+func newYAMLMap() *yamlMap {
+	return &yamlMap{values: make(map[string]any)}
+}
+
+func (m *yamlMap) set(key string, value any) {
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+func (m *yamlMap) get(key string) (any, bool) {
+	v, ok := m.values[key]
+	return v, ok
+}
+
+// parseYAML parses content into nested *yamlMap, []any, string and nil
+// (for null) values. Scalars are kept as written, so 0755 or 1.10 are not
+// turned into numbers
+func parseYAML(content string) (any, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &doc); err != nil {
+		return nil, fmt.Errorf("invalid YAML: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	budget := MAX_YAML_VALUES
+	return yamlValue(doc.Content[0], &budget)
+}
+
+// yamlValue converts a node, counting every value against budget
+func yamlValue(n *yaml.Node, budget *int) (any, error) {
+	if *budget--; *budget < 0 {
+		return nil, fmt.Errorf("line %d: document has more than %d values once aliases are expanded", n.Line, MAX_YAML_VALUES)
+	}
+
+	switch n.Kind {
+	case yaml.AliasNode:
+		return yamlValue(n.Alias, budget)
+
+	case yaml.ScalarNode:
+		if n.Tag == "!!null" {
+			return nil, nil
+		}
+		return n.Value, nil
+
+	case yaml.SequenceNode:
+		items := []any{}
+		for _, item := range n.Content {
+			v, err := yamlValue(item, budget)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		return items, nil
+
+	case yaml.MappingNode:
+		m := newYAMLMap()
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			v, err := yamlValue(value, budget)
+			if err != nil {
+				return nil, err
+			}
+			if key.Tag == "!!merge" {
+				if err := mergeYAML(m, v); err != nil {
+					return nil, fmt.Errorf("line %d: %w", key.Line, err)
+				}
+				continue
+			}
+			m.set(key.Value, v)
+		}
+		return m, nil
+	}
+
+	return nil, fmt.Errorf("line %d: unsupported YAML node", n.Line)
+}
+
+// mergeYAML applies a merge key (<<: *anchor). Keys of the mapping itself
+// take precedence over merged ones
+func mergeYAML(m *yamlMap, merged any) error {
+	switch merged := merged.(type) {
+	case *yamlMap:
+		for _, key := range merged.keys {
+			if _, ok := m.values[key]; !ok {
+				m.set(key, merged.values[key])
+			}
+		}
+		return nil
+	case []any:
+		for _, item := range merged {
+			if err := mergeYAML(m, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("merge key needs a mapping")
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// Signals relayed to the child process of `run`
+var forwardedSignals = []os.Signal{os.Interrupt}
+
+// exitCode returns the exit code of the child
+func exitCode(state *os.ProcessState) int {
+	return state.ExitCode()
+}